@@ -1,11 +1,14 @@
 package adapters
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/go-resty/resty/v2"
 	"github.com/qoalis/go-micro/micro"
 	"github.com/qoalis/go-micro/util/h"
 	log "github.com/sirupsen/logrus"
+	"strings"
 )
 
 type discordClient struct {
@@ -14,6 +17,14 @@ type discordClient struct {
 	client     *resty.Client
 }
 
+var severityColors = map[micro.Severity]int{
+	micro.SeverityDebug:    0x95a5a6,
+	micro.SeverityInfo:     0x3498db,
+	micro.SeverityWarning:  0xf39c12,
+	micro.SeverityError:    0xe74c3c,
+	micro.SeverityCritical: 0x8e0000,
+}
+
 func NewDiscordClient(webhook string) micro.NotificationService {
 	if webhook == "" {
 		log.Fatal("no notifications manager found, skipping notification")
@@ -25,18 +36,54 @@ func NewDiscordClient(webhook string) micro.NotificationService {
 	}
 }
 
+// Ping fetches the webhook, which does not post anything
+func (s *discordClient) Ping(ctx context.Context) error {
+	// the url holds the webhook secret, it is left out of the errors
+	out, err := s.client.R().SetContext(ctx).Get(s.webHookUrl)
+	if err != nil {
+		return errors.New("discord webhook is unreachable")
+	}
+	if out.IsError() {
+		return fmt.Errorf("discord webhook is unavailable -- %s", out.Status())
+	}
+	return nil
+}
+
 func (s *discordClient) Send(_ micro.Ctx, message micro.Notification) error {
 	out, err := s.client.R().
-		SetBody(h.Map{
-			"content": message.Message,
-		}).
+		SetBody(discordPayload(message)).
 		SetContentLength(true).
 		Post(s.webHookUrl)
 	if err != nil {
-		return fmt.Errorf("failed to send discord message -- %v", err)
+		return fmt.Errorf("failed to send discord message -- %v", redactUrl(err))
 	}
 	if out.IsError() {
 		return fmt.Errorf("failed to send discord message -- %v", out.Body())
 	}
 	return nil
 }
+
+// discordPayload renders plain notifications as content and rich ones as an embed
+func discordPayload(message micro.Notification) h.Map {
+	if message.Title == "" && message.Severity == "" && len(message.Fields) == 0 && len(message.Links) == 0 {
+		return h.Map{"content": message.Message}
+	}
+	description := message.Message
+	for _, link := range message.Links {
+		description += fmt.Sprintf("\n[%s](%s)", link.Label, link.Url)
+	}
+	fields := make([]h.Map, 0, len(message.Fields))
+	for _, field := range message.Fields {
+		fields = append(fields, h.Map{"name": field.Name, "value": field.Value, "inline": field.Inline})
+	}
+	embed := h.Map{
+		"title":       message.Title,
+		"description": strings.TrimSpace(description),
+		"color":       severityColors[severityOf(message)],
+		"fields":      fields,
+	}
+	if footer := notificationFooter(message); footer != "" {
+		embed["footer"] = h.Map{"text": footer}
+	}
+	return h.Map{"embeds": []h.Map{embed}}
+}
@@ -2,6 +2,7 @@ package adapters
 
 import (
 	"context"
+	goerrors "errors"
 	"fmt"
 	"github.com/getsentry/sentry-go"
 	sentryecho "github.com/getsentry/sentry-go/echo"
@@ -9,6 +10,7 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/qoalis/go-micro/di"
 	"github.com/qoalis/go-micro/micro"
 	"github.com/qoalis/go-micro/schema"
 	"github.com/qoalis/go-micro/util/digest"
@@ -17,11 +19,11 @@ import (
 	log "github.com/sirupsen/logrus"
 	echoSwagger "github.com/swaggo/echo-swagger"
 	"github.com/thoas/go-funk"
-	"io"
 	"net/http"
 	"net/url"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -77,6 +79,11 @@ type echoRouterAdapter struct {
 	micro.Router
 	e   *echo.Echo
 	cfg micro.RouterConfig
+	env *micro.Env
+	// handlers are checked when the app starts, see CheckHandlers
+	handlers *handlerSpecs
+	// watches keep the proxy upstreams in sync with the service registry until the shutdown
+	watches []context.CancelFunc
 }
 
 func NewEchoAdapter(env *micro.Env, config micro.RouterConfig) micro.Router {
@@ -248,9 +255,24 @@ func NewEchoAdapter(env *micro.Env, config micro.RouterConfig) micro.Router {
 		})
 	}
 
-	e.GET("/health", func(c echo.Context) error {
-		status := schema.NewHealthStatus()
+	if env.Health == nil {
+		env.Health = micro.NewHealthProbe(env, micro.HealthConfig{})
+	}
+	ready := func(c echo.Context) error {
+		status := env.Health.Ready(c.Request().Context())
+		// the health endpoints are public, the errors can reveal internal addresses
+		if !env.Health.ShowDetails(c.Request()) {
+			status = status.WithoutDetails()
+		}
+		if status.Status != "UP" {
+			return c.JSON(http.StatusServiceUnavailable, status)
+		}
 		return c.JSON(http.StatusOK, status)
+	}
+	e.GET("/health", ready)
+	e.GET("/health/ready", ready)
+	e.GET("/health/live", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, env.Health.Live())
 	})
 
 	if !config.Production && env.TokenProvider != nil {
@@ -280,7 +302,7 @@ func NewEchoAdapter(env *micro.Env, config micro.RouterConfig) micro.Router {
 		log.Infof("DEV token endpoint is available at /dev/token?tenant=<tenant>")
 	}
 
-	return &echoRouterAdapter{e: e, cfg: config}
+	return &echoRouterAdapter{e: e, cfg: config, env: env, handlers: &handlerSpecs{}}
 }
 
 func (r *echoRouterAdapter) Handler() http.Handler {
@@ -291,8 +313,11 @@ func (r *echoRouterAdapter) Start(addr string) error {
 	return r.e.Start(addr)
 }
 
-func (r *echoRouterAdapter) Shutdown() error {
-	return r.e.Shutdown(context.Background())
+func (r *echoRouterAdapter) Shutdown(ctx context.Context) error {
+	for _, cancel := range r.watches {
+		cancel()
+	}
+	return r.e.Shutdown(ctx)
 }
 
 func (r *echoRouterAdapter) GET(path string, handler interface{}, filters ...micro.MiddlewareFunc) {
@@ -316,90 +341,70 @@ func (r *echoRouterAdapter) DELETE(path string, handler interface{}, filters ...
 }
 
 func (r *echoRouterAdapter) request(method string, path string, handler interface{}, filters []micro.MiddlewareFunc) {
+	spec := r.handlers.add(analyzeHandler(r.env, method, path, handler))
 	r.e.Match([]string{method}, r.path(path), func(c echo.Context) (err error) {
 		defer func() {
 			if err0 := recover(); err0 != nil {
 				err = mapHttpResponse(c, err0.(error))
 			}
 		}()
-		return handleRequest(c, handler)
+		return handleRequest(c, spec)
 	}, createMiddlewares(filters)...)
 }
 
 func (r *echoRouterAdapter) Group(path string, filters ...micro.MiddlewareFunc) micro.BaseRouter {
 	middlewares := createMiddlewares(filters)
 	return &echoGroupRoute{
-		g: r.e.Group(r.path(path), middlewares...),
+		g:        r.e.Group(r.path(path), middlewares...),
+		env:      r.env,
+		handlers: r.handlers,
 	}
 }
 
+// CheckHandlers tells whether the parameters of every handler can be resolved, it is run by
+// App.Start once the components are provided
+func (r *echoRouterAdapter) CheckHandlers() error {
+	return r.handlers.check()
+}
+
 func (r *echoRouterAdapter) Proxy(path string, upstreams *micro.RouterUpstream, middlewares ...micro.MiddlewareFunc) {
-	r.e.Any(path, func(c echo.Context) error {
-		uriParts := strings.Split(c.Request().URL.Path, "?")
-		requestUri := uriParts[0]
-		requestQuery := ""
-		if len(uriParts) > 1 {
-			requestQuery = uriParts[1]
+	if r.env != nil && r.env.Registry != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := upstreams.Watch(ctx, r.env.Registry); err != nil {
+			log.Errorf("unable to watch the upstreams of %s -- %v", path, err)
 		}
-		upstream := upstreams.Lookup(requestUri)
+		r.watches = append(r.watches, cancel)
+	}
+	proxy := newReverseProxy(r.cfg.ProxyTransport, parseTrustedProxies(r.cfg.TrustedProxies))
+	r.e.Any(path, func(c echo.Context) error {
+		requestUri := c.Request().URL.Path
+		upstream := upstreams.Match(c.Request())
 		if upstream == nil {
 			return echo.NewHTTPError(http.StatusNotFound, "no_upstream_found")
 		}
-
-		var chain string
 		basePath := strings.TrimPrefix(requestUri, upstream.Prefix)
 		alwayStrip := strings.HasPrefix(basePath, "/swagger") || strings.HasPrefix(basePath, "/health")
-
 		if upstream.Strip || alwayStrip {
-			chain = h.F(url.JoinPath(upstream.Uri, basePath))
-		} else {
-			chain = h.F(url.JoinPath(upstream.Uri, requestUri))
+			requestUri = basePath
 		}
-
-		if requestQuery != "" {
-			chain = strings.Join([]string{chain, requestQuery}, "?")
+		requestUri = upstream.RewritePath(requestUri)
+		handler := func(c echo.Context) error {
+			return serveProxy(c, proxy, upstream, requestUri)
 		}
-		req, _ := http.NewRequest(
-			c.Request().Method,
-			chain,
-			c.Request().Body,
-		)
-		copyHeader(c.Request().Header, req.Header)
-
-		authz := c.Get(micro.AuthKey)
-		if authz != nil {
-			_authz := authz.(*micro.Authentication)
-			if _authz.Authenticated && _authz.Authorization != "" {
-				log.Info("[proxy] authentication found in current context, passing down")
-				req.Header.Set("Authorization", _authz.Authorization)
+		for i := len(upstream.Filters) - 1; i >= 0; i-- {
+			filter, next := upstream.Filters[i], handler
+			handler = func(c echo.Context) error {
+				return runFilter(c, filter, next)
 			}
 		}
-
-		resp, err := http.DefaultClient.Do(req)
-
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-		}
-		//goland:noinspection ALL
-		defer resp.Body.Close()
-		copyHeader(resp.Header, c.Response().Header())
-		c.Response().WriteHeader(resp.StatusCode)
-		_, err = io.Copy(c.Response().Writer, resp.Body)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusBadGateway, "Failed to send upstream response")
-		}
-
-		return nil
+		return handler(c)
 	}, createMiddlewares(middlewares)...)
 }
 
 func (r *echoRouterAdapter) Use(filter micro.MiddlewareFunc) {
 	r.e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			if err := filter(createRouteContext(c)); err != nil {
-				return mapHttpResponse(c, err)
-			}
-			return next(c)
+			return runFilter(c, filter, next)
 		}
 	})
 }
@@ -412,22 +417,16 @@ func (r *echoRouterAdapter) path(path string) string {
 	return newPath
 }
 
-func copyHeader(src, dst http.Header) {
-	for k, vv := range src {
-		for _, v := range vv {
-			dst.Add(k, v)
-		}
-	}
-}
-
 // =================================================================================
 // ECHO GROUP ROUTE
 // =================================================================================
 
 type echoGroupRoute struct {
 	micro.BaseRouter
-	g   *echo.Group
-	ctx micro.Ctx
+	g        *echo.Group
+	ctx      micro.Ctx
+	env      *micro.Env
+	handlers *handlerSpecs
 }
 
 func (r *echoGroupRoute) GET(path string, handler interface{}, filters ...micro.MiddlewareFunc) {
@@ -476,6 +475,7 @@ func (r *echoGroupRoute) Resource(resource string, model any) {
 */
 
 func (r *echoGroupRoute) request(method string, path string, handler interface{}, filters []micro.MiddlewareFunc) {
+	spec := r.handlers.add(analyzeHandler(r.env, method, path, handler))
 
 	if method == "*" {
 		r.g.Any(path, func(c echo.Context) (err error) {
@@ -485,7 +485,7 @@ func (r *echoGroupRoute) request(method string, path string, handler interface{}
 					err = mapHttpResponse(c, err0.(error))
 				}
 			}()
-			return mapHttpResponse(c, handleRequest(c, handler))
+			return mapHttpResponse(c, handleRequest(c, spec))
 		}, createMiddlewares(filters)...)
 		return
 	}
@@ -497,7 +497,7 @@ func (r *echoGroupRoute) request(method string, path string, handler interface{}
 				err = mapHttpResponse(c, err0.(error))
 			}
 		}()
-		return mapHttpResponse(c, handleRequest(c, handler))
+		return mapHttpResponse(c, handleRequest(c, spec))
 
 	}, createMiddlewares(filters)...)
 }
@@ -506,28 +506,135 @@ func (r *echoGroupRoute) request(method string, path string, handler interface{}
 // GENERIC HANDLER
 // =================================================================================
 
-//goland:noinspection GoTypeAssertionOnErrors
-func handleRequest(c echo.Context, handler interface{}) (err error) {
-	handlerType := reflect.TypeOf(handler)
+const (
+	handlerArgInput = iota
+	handlerArgAuth
+	handlerArgComponent
+)
 
-	if handlerType.Kind() != reflect.Func {
-		return mapHttpResponse(c, fmt.Errorf("controller method is not a function"))
+type handlerArg struct {
+	kind int
+	typ  reflect.Type
+	// pointer inputs are bound to a new value of the element type
+	pointer bool
+}
+
+// handlerSpec is the result of the analysis of a route handler. The signature is checked at
+// registration, the parameters are classified on first use (App.Start or the first request) so
+// that they do not depend on the order of the Provide calls.
+type handlerSpec struct {
+	name   string
+	fn     reflect.Value
+	env    *micro.Env
+	params []reflect.Type
+	once   sync.Once
+	args   []handlerArg
+	err    error
+}
+
+// handlerSpecs are the handlers of a router and of its groups
+type handlerSpecs struct {
+	mu   sync.Mutex
+	list []*handlerSpec
+}
+
+func (s *handlerSpecs) add(spec *handlerSpec) *handlerSpec {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.list = append(s.list, spec)
+	return spec
+}
+
+func (s *handlerSpecs) check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, spec := range s.list {
+		if _, err := spec.resolve(); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	return goerrors.Join(errs...)
+}
+
+var ctxType = reflect.TypeOf(micro.Ctx{})
+var authenticationType = reflect.TypeOf(&micro.Authentication{})
+
+// analyzeHandler checks the signature of a route handler: func(micro.Ctx, params...) (any, error).
+// Parameters after the context are resolved per request:
+//
+//   - *micro.Authentication: the current user, the route answers 401 when the request is anonymous
+//   - the types provided by the container: resolved from the request di scope (see micro.Ctx.Scope)
+//   - the first other struct, or pointer to a struct: the input, bound from the request
+func analyzeHandler(env *micro.Env, method string, path string, handler interface{}) *handlerSpec {
+	spec, err := newHandlerSpec(env, handler)
+	if err != nil {
+		log.Fatalf("invalid handler for %s %s -- %v", method, path, err)
+	}
+	spec.name = method + " " + path
+	return spec
+}
 
-	numIn := handlerType.NumIn()
-	if numIn == 0 {
-		return mapHttpResponse(c, fmt.Errorf("controller method must have at least one argument (micro.Ctx)"))
+func newHandlerSpec(env *micro.Env, handler interface{}) (*handlerSpec, error) {
+	handlerType := reflect.TypeOf(handler)
+	if handlerType == nil || handlerType.Kind() != reflect.Func {
+		return nil, fmt.Errorf("controller method is not a function")
+	}
+	if handlerType.NumIn() == 0 || handlerType.In(0) != ctxType {
+		return nil, fmt.Errorf("handler must be a function with the first argument of type micro.Ctx")
 	}
-	if numIn > 2 {
-		return mapHttpResponse(c, fmt.Errorf("controller method must have at most two arguments (micro.Ctx, input binding)"))
+	if handlerType.NumOut() > 2 {
+		return nil, fmt.Errorf("invalid handler return type")
 	}
+	spec := &handlerSpec{fn: reflect.ValueOf(handler), env: env}
+	for i := 1; i < handlerType.NumIn(); i++ {
+		spec.params = append(spec.params, handlerType.In(i))
+	}
+	return spec, nil
+}
+
+// resolve classifies the parameters of the handler, once
+func (spec *handlerSpec) resolve() ([]handlerArg, error) {
+	spec.once.Do(func() {
+		hasInput := false
+		for _, t := range spec.params {
+			switch {
+			case t == authenticationType:
+				spec.args = append(spec.args, handlerArg{kind: handlerArgAuth, typ: t})
+			case isProvided(spec.env, t):
+				spec.args = append(spec.args, handlerArg{kind: handlerArgComponent, typ: t})
+			case isInputType(t) && !hasInput:
+				hasInput = true
+				spec.args = append(spec.args, handlerArg{kind: handlerArgInput, typ: t, pointer: t.Kind() == reflect.Ptr})
+			case isInputType(t):
+				spec.err = fmt.Errorf("handler %s can only bind one input and %s is not provided by the container", spec.name, t)
+				return
+			default:
+				spec.err = fmt.Errorf("handler %s expects %s which is not provided by the container", spec.name, t)
+				return
+			}
+		}
+	})
+	return spec.args, spec.err
+}
 
-	firstArgType := handlerType.In(0)
+func isInputType(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct || (t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct)
+}
 
-	if firstArgType != reflect.TypeOf(micro.Ctx{}) {
-		return fmt.Errorf("handler must be a function with the first argument of type micro.Ctx")
-	}
+func isProvided(env *micro.Env, t reflect.Type) bool {
+	return env != nil && env.Container != nil && env.Container.Has(t)
+}
 
+func handleRequest(c echo.Context, spec *handlerSpec) (err error) {
+	// the request components are stopped once the response is written
+	defer func() {
+		if scope, ok := c.Get(micro.ScopeKey).(*di.Container); ok {
+			if closeErr := scope.Close(context.WithoutCancel(c.Request().Context())); closeErr != nil {
+				log.Error(closeErr)
+			}
+		}
+	}()
 	ctx := createRouteContext(c)
 	tenantId := ctx.TenantId
 	if tenantId == "" {
@@ -538,34 +645,64 @@ func handleRequest(c echo.Context, handler interface{}) (err error) {
 
 	disabledTx := c.Get(micro.DisableImplicitTransaction)
 	if disabledTx == "1" {
-		return mapHttpResponse(c, invokeHandler(c, ctx, handler, handlerType, numIn))
+		return mapHttpResponse(c, invokeHandler(c, ctx, spec))
 	}
 	return ctx.Tx(func(tx micro.Ctx) error {
-		return mapHttpResponse(c, invokeHandler(c, tx, handler, handlerType, numIn))
+		return mapHttpResponse(c, invokeHandler(c, tx, spec))
 	})
 }
 
-func invokeHandler(c echo.Context, tx micro.Ctx, handler interface{}, handlerType reflect.Type, numIn int) error {
-	args := []reflect.Value{reflect.ValueOf(tx)}
-
-	if numIn == 2 {
-		inputType := handlerType.In(1)
-		inputValue := reflect.New(inputType).Elem()
-		modelInput := inputValue.Addr().Interface() //
-		if err := Bind(c, modelInput); err != nil {
-			log.Errorf("validation failed for %s\n%v", c.Request().RequestURI, err.Error())
-			return err
+func invokeHandler(c echo.Context, tx micro.Ctx, spec *handlerSpec) error {
+	specArgs, err := spec.resolve()
+	if err != nil {
+		return errors.Technical(err.Error())
+	}
+	args := make([]reflect.Value, 0, len(specArgs)+1)
+	args = append(args, reflect.ValueOf(tx))
+
+	var scope *di.Container
+	for _, arg := range specArgs {
+		switch arg.kind {
+		case handlerArgAuth:
+			if !tx.IsAuthenticated() {
+				return errors.Unauthorized("authentication_required")
+			}
+			args = append(args, reflect.ValueOf(tx.Auth))
+		case handlerArgInput:
+			typ := arg.typ
+			if arg.pointer {
+				typ = typ.Elem()
+			}
+			input := reflect.New(typ)
+			if err := Bind(c, input.Interface()); err != nil {
+				log.Errorf("validation failed for %s\n%v", c.Request().RequestURI, err.Error())
+				return err
+			}
+			if arg.pointer {
+				args = append(args, input)
+			} else {
+				args = append(args, input.Elem())
+			}
+		case handlerArgComponent:
+			if scope == nil {
+				if scope = tx.Scope(); scope == nil {
+					return errors.Technical(fmt.Sprintf("unable to inject %s in %s -- %v", arg.typ, spec.name, micro.ErrNoContainer))
+				}
+				// the components of the request use the transaction of the handler
+				di.Bind(scope, tx)
+			}
+			value, err := scope.Resolve(arg.typ)
+			if err != nil {
+				return errors.Technical(fmt.Sprintf("unable to inject %s in %s -- %v", arg.typ, spec.name, err))
+			}
+			if !value.IsValid() {
+				value = reflect.Zero(arg.typ)
+			}
+			args = append(args, value)
 		}
-		args = append(args, inputValue)
 	}
 
-	handlerValue := reflect.ValueOf(handler)
-
-	res := handlerValue.Call(args)
-
-	if len(res) > 2 {
-		return fmt.Errorf("invalid handler return type")
-	}
+	res := spec.fn.Call(args)
 
 	var result interface{}
 
@@ -656,15 +793,35 @@ func createMiddlewares(filters []micro.MiddlewareFunc) []echo.MiddlewareFunc {
 	return funk.Map(filters, func(filter micro.MiddlewareFunc) echo.MiddlewareFunc {
 		return func(next echo.HandlerFunc) echo.HandlerFunc {
 			return func(c echo.Context) error {
-				if err := filter(createRouteContext(c)); err != nil {
-					return mapHttpResponse(c, err)
-				}
-				return next(c)
+				return runFilter(c, filter, next)
 			}
 		}
 	}).([]echo.MiddlewareFunc)
 }
 
+// runFilter applies a middleware then the rest of the chain, and runs the callbacks the middleware
+// registered with Ctx.AfterHandler once the chain has returned
+func runFilter(c echo.Context, filter micro.MiddlewareFunc, next echo.HandlerFunc) error {
+	before := len(afterHandlers(c))
+	if err := filter(createRouteContext(c)); err != nil {
+		if goerrors.Is(err, micro.ErrResponseCommitted) {
+			return nil
+		}
+		return mapHttpResponse(c, err)
+	}
+	registered := append([]func(error){}, afterHandlers(c)[before:]...)
+	err := next(c)
+	for i := len(registered) - 1; i >= 0; i-- {
+		registered[i](err)
+	}
+	return err
+}
+
+func afterHandlers(c echo.Context) []func(error) {
+	callbacks, _ := c.Get(micro.AfterHandlersKey).([]func(error))
+	return callbacks
+}
+
 func createRouteContext(c echo.Context) micro.Ctx {
 	env := c.Get(micro.EnvKey).(*micro.Env)
 	value := c.Get(micro.AuthKey)
@@ -0,0 +1,78 @@
+package adapters_test
+
+import (
+	"context"
+	"github.com/qoalis/go-micro/adapters"
+	"github.com/qoalis/go-micro/di"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/tests"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+)
+
+type greeter struct {
+	greeting string
+}
+
+// unitOfWork is a request component, it is stopped at the end of the request
+type unitOfWork struct {
+	stopped *atomic.Int32
+}
+
+func (u *unitOfWork) Stop(context.Context) error {
+	u.stopped.Add(1)
+	return nil
+}
+
+type greetInput struct {
+	Name string `query:"name"`
+}
+
+func TestHandlerInjection(t *testing.T) {
+	t.Setenv(micro.ServerToken, "secret")
+	app := adapters.NewApp("inject", "1.0", micro.Cfg{DisableImplicitTransaction: true})
+	app.Init(nil)
+
+	app.Router.GET("/greet", func(ctx micro.Ctx, input greetInput, g *greeter, tokens micro.TokenProvider) (any, error) {
+		return map[string]any{"message": g.greeting + " " + input.Name, "tokens": tokens != nil}, nil
+	})
+	app.Router.GET("/me", func(ctx micro.Ctx, auth *micro.Authentication) (any, error) {
+		return map[string]any{"user": auth.UserId}, nil
+	})
+	app.Router.GET("/hello", func(ctx micro.Ctx, input *greetInput, _ *unitOfWork) (any, error) {
+		return map[string]any{"message": "Hello " + input.Name}, nil
+	})
+	// the components can be provided after the routes
+	_ = app.Container.Provide(func() *greeter { return &greeter{greeting: "Hello"} })
+	var stopped atomic.Int32
+	_ = app.Container.Provide(func() *unitOfWork { return &unitOfWork{stopped: &stopped} }, di.InScope(di.Request))
+	assert.Nil(t, app.Start(context.Background()))
+
+	f := tests.HttpTestApp(t, app, nil)
+	res := f.GET("/greet").Params(map[string]any{"name": "Jane"}).Expect().IsOK().JSON().Object()
+	res.Path("$.message").String().IsEqual("Hello Jane")
+	res.Path("$.tokens").Boolean().IsTrue()
+
+	f.GET("/hello").Params(map[string]any{"name": "John"}).Expect().IsOK().JSON().Object().
+		Path("$.message").String().IsEqual("Hello John")
+	assert.Equal(t, int32(1), stopped.Load())
+
+	f.GET("/me").Expect().IsUnauthorized()
+	f.AsUser("user_1", nil, nil, "").GET("/me").Expect().IsOK().JSON().Object().Path("$.user").String().IsEqual("user_1")
+}
+
+type unknownService interface {
+	Call() error
+}
+
+func TestHandlerInjectionCheckedOnStart(t *testing.T) {
+	app := adapters.NewApp("inject", "1.0", micro.Cfg{DisableImplicitTransaction: true})
+	app.Init(nil)
+	app.Router.GET("/call", func(ctx micro.Ctx, service unknownService) (any, error) {
+		return nil, service.Call()
+	})
+	err := app.Start(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "GET /call expects adapters_test.unknownService which is not provided by the container")
+}
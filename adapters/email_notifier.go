@@ -0,0 +1,84 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qoalis/go-micro/micro"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+type emailNotifier struct {
+	micro.NotificationService
+	env  *micro.Env
+	to   []micro.EmailAddress
+	from *micro.EmailAddress
+}
+
+// NewEmailNotifier parses email://ops@example.com?to=other@example.com&from=noreply@example.com and
+// sends the notifications with the env mailer
+func NewEmailNotifier(env *micro.Env, value string) (micro.NotificationService, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	n := &emailNotifier{env: env}
+	recipients := u.Query()["to"]
+	if u.Host != "" {
+		recipients = append([]string{u.User.String() + "@" + u.Host}, recipients...)
+	}
+	for _, recipient := range recipients {
+		addr, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return nil, err
+		}
+		n.to = append(n.to, micro.EmailAddress{Name: addr.Name, Address: addr.Address})
+	}
+	if len(n.to) == 0 {
+		return nil, errors.New("email notifier recipient is missing")
+	}
+	if n.from, err = parseMailerFrom(u.Query()); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Ping probes the env mailer when it is a micro.Pinger
+func (s *emailNotifier) Ping(ctx context.Context) error {
+	if pinger, ok := s.env.Mailer.(micro.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (s *emailNotifier) Send(ctx micro.Ctx, message micro.Notification) error {
+	env := s.env
+	if ctx.Env != nil {
+		env = ctx.Env
+	}
+	if env == nil || env.Mailer == nil {
+		return errors.New("email notifier requires a mailer")
+	}
+	subject := message.Title
+	if subject == "" {
+		subject = message.Topic
+	}
+	if subject == "" {
+		subject = "Notification"
+	}
+	if env.AppName != "" {
+		subject = fmt.Sprintf("[%s] %s", env.AppName, subject)
+	}
+	if severity := severityOf(message); severity != micro.SeverityInfo {
+		subject = fmt.Sprintf("%s (%s)", subject, strings.ToUpper(string(severity)))
+	}
+	return env.Mailer.Send(ctx, micro.Email{
+		From:       s.from,
+		To:         s.to,
+		Subject:    subject,
+		TextBody:   notificationText(message),
+		Categories: []string{"notification"},
+	})
+}
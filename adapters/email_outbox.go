@@ -0,0 +1,357 @@
+package adapters
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	goerrors "errors"
+	"fmt"
+	"github.com/qoalis/go-micro/di"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/schema"
+	"github.com/qoalis/go-micro/util/dates"
+	"github.com/qoalis/go-micro/util/errors"
+	"github.com/qoalis/go-micro/util/ids"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/email_outbox/*.sql
+var emailOutboxMigrations embed.FS
+
+const (
+	EmailOutboxTable           = "_email_outbox"
+	EmailOutboxMigrationsTable = "_email_outbox_version"
+)
+
+const (
+	EmailQueued  = "queued"
+	EmailSent    = "sent"
+	EmailFailed  = "failed"
+	EmailBounced = "bounced"
+)
+
+type EmailOutboxConfig struct {
+	// Interval of the delivery worker, defaults to 30s
+	Interval string
+	// MaxAttempts before an email is marked as failed, defaults to 5. Emails rejected by the
+	// provider (micro.MailerError not retryable) fail on the first attempt.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled on every attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// BatchSize is the number of emails delivered per tenant and run, defaults to 50
+	BatchSize int
+	// Routes, when set, is the path prefix of the endpoints used to inspect and resend emails.
+	// Filters are required with Routes and should restrict these endpoints to administrators.
+	Routes  string
+	Filters []micro.MiddlewareFunc
+}
+
+// OutboxEmail is the persisted state of a queued email
+type OutboxEmail struct {
+	Id            string     `json:"id" gorm:"primaryKey"`
+	MessageKey    string     `json:"messageKey"`
+	TenantId      string     `json:"tenantId"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     *string    `json:"lastError,omitempty"`
+	Recipients    string     `json:"recipients"`
+	Subject       string     `json:"subject"`
+	Payload       string     `json:"-"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	SentAt        *time.Time `json:"sentAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+func (OutboxEmail) TableName() string {
+	return EmailOutboxTable
+}
+
+type OutboxQuery struct {
+	Status string `query:"status"`
+	schema.PagingInput
+}
+
+// QueuedMailer persists emails in the tenant database and delivers them asynchronously with
+// the underlying mailer, retrying failures with an exponential backoff. Emails queued inside a
+// transaction are only delivered once it is committed.
+type QueuedMailer struct {
+	micro.Mailer
+	next micro.Mailer
+	cfg  EmailOutboxConfig
+}
+
+// EmailOutbox is a feature replacing env.Mailer with a QueuedMailer
+func EmailOutbox(cfg ...EmailOutboxConfig) micro.Feature {
+	config := EmailOutboxConfig{}
+	if len(cfg) > 0 {
+		config = cfg[0]
+	}
+	return micro.Feature{
+		Name: "email_outbox",
+		Configure: func(app *micro.App) {
+			env := app.Env
+			if env.Mailer == nil {
+				log.Fatalf("email outbox requires a mailer, set env.%s", micro.EmailSender)
+			}
+			if env.DataSources == nil {
+				log.Fatalf("email outbox requires a database, set env.%s", micro.DatabaseUrl)
+			}
+			for _, ds := range env.DataSources {
+				ds.Migrate(emailOutboxMigrations, "migrations/email_outbox", EmailOutboxMigrationsTable)
+			}
+			mailer := NewQueuedMailer(env.Mailer, config)
+			env.Mailer = mailer
+			di.Register(micro.MailerServer, mailer)
+			env.Scheduler.EveryTenant(mailer.cfg.Interval, mailer.Flush)
+			if config.Routes != "" && app.Router != nil {
+				mailer.RegisterRoutes(app.Router.Group(config.Routes), config.Filters...)
+			}
+		},
+	}
+}
+
+func NewQueuedMailer(next micro.Mailer, cfg EmailOutboxConfig) *QueuedMailer {
+	if cfg.Interval == "" {
+		cfg.Interval = "30s"
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Minute
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Hour
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 50
+	}
+	return &QueuedMailer{next: next, cfg: cfg}
+}
+
+// Send queues the email, it is a no-op when an email with the same MessageKey is already queued
+// for the tenant
+func (m *QueuedMailer) Send(ctx micro.Ctx, message micro.Email) error {
+	db := ctx.DB()
+	if db == nil {
+		return goerrors.New("email outbox: no db found in current context")
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	key := message.MessageKey
+	if key == "" {
+		key = ids.NewId("")
+	}
+	now := dates.Now()
+	_, err = db.Raw(micro.Query{
+		Raw: "INSERT INTO " + EmailOutboxTable + " (id, message_key, tenant_id, status, attempts, recipients, subject, payload, next_attempt_at, created_at, updated_at) " +
+			"VALUES (?, ?, ?, ?, 0, ?, ?, ?, ?, ?, ?) ON CONFLICT (tenant_id, message_key) DO NOTHING",
+		Args: []any{
+			ids.NewId("eml"), key, ctx.TenantId, EmailQueued, strings.Join(message.Recipients(), ","),
+			message.Subject, string(payload), now, now, now,
+		},
+	})
+	return err
+}
+
+// Ping probes the underlying mailer when it is a micro.Pinger
+func (m *QueuedMailer) Ping(ctx context.Context) error {
+	if pinger, ok := m.next.(micro.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (m *QueuedMailer) SendBatch(ctx micro.Ctx, messages []micro.Email) error {
+	var errs []error
+	for _, message := range messages {
+		errs = append(errs, m.Send(ctx, message))
+	}
+	return goerrors.Join(errs...)
+}
+
+// Flush delivers the due emails of the context tenant, it is run by the scheduler
+func (m *QueuedMailer) Flush(ctx micro.Ctx) error {
+	db := ctx.DB()
+	if db == nil {
+		return nil
+	}
+	var due []OutboxEmail
+	if err := db.Find(&due, micro.Query{
+		Raw: "SELECT * FROM " + EmailOutboxTable + " WHERE tenant_id = ? AND status = ? AND next_attempt_at <= ? " +
+			"ORDER BY next_attempt_at LIMIT ?",
+		Args: []any{ctx.TenantId, EmailQueued, dates.Now(), m.cfg.BatchSize},
+	}); err != nil {
+		return err
+	}
+	var errs []error
+	for _, record := range due {
+		if err := m.deliver(ctx, db, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return goerrors.Join(errs...)
+}
+
+func (m *QueuedMailer) deliver(ctx micro.Ctx, db micro.DataSource, record OutboxEmail) error {
+	// claim the email so concurrent workers skip it until the lease expires, the lease moves
+	// next_attempt_at past now so that a single worker claims a due email
+	now := dates.Now()
+	claimed, err := db.Raw(micro.Query{
+		Raw: "UPDATE " + EmailOutboxTable + " SET next_attempt_at = ?, updated_at = ? " +
+			"WHERE id = ? AND status = ? AND attempts = ? AND next_attempt_at <= ?",
+		Args: []any{now.Add(m.cfg.MaxBackoff), now, record.Id, EmailQueued, record.Attempts, now},
+	})
+	if err != nil || claimed == 0 {
+		return err
+	}
+
+	var message micro.Email
+	if err = json.Unmarshal([]byte(record.Payload), &message); err == nil {
+		err = m.next.Send(ctx, message)
+	}
+	now = dates.Now()
+	if err == nil {
+		_, err = db.Patch(&OutboxEmail{}, record.Id, map[string]interface{}{
+			"status":     EmailSent,
+			"attempts":   record.Attempts + 1,
+			"last_error": nil,
+			"sent_at":    now,
+			"updated_at": now,
+		})
+		return err
+	}
+
+	attempts := record.Attempts + 1
+	update := map[string]interface{}{
+		"attempts":   attempts,
+		"last_error": err.Error(),
+		"updated_at": now,
+	}
+	var mailerErr *micro.MailerError
+	if attempts >= m.cfg.MaxAttempts || (goerrors.As(err, &mailerErr) && !mailerErr.Retryable()) {
+		update["status"] = EmailFailed
+		update["next_attempt_at"] = nil
+	} else {
+		update["next_attempt_at"] = now.Add(m.backoff(attempts))
+	}
+	log.Warnf("email %s delivery failed (attempt %d/%d) -- %v", record.Id, attempts, m.cfg.MaxAttempts, err)
+	if _, patchErr := db.Patch(&OutboxEmail{}, record.Id, update); patchErr != nil {
+		return patchErr
+	}
+	return fmt.Errorf("email %s delivery failed -- %v", record.Id, err)
+}
+
+func (m *QueuedMailer) backoff(attempts int) time.Duration {
+	delay := m.cfg.Backoff
+	for i := 1; i < attempts && delay < m.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > m.cfg.MaxBackoff {
+		return m.cfg.MaxBackoff
+	}
+	return delay
+}
+
+// List returns the emails of the context tenant, most recent first
+func (m *QueuedMailer) List(ctx micro.Ctx, query OutboxQuery) (schema.EntityList[OutboxEmail], error) {
+	var data []OutboxEmail
+	limit, offset := 100, 0
+	if query.Count > 0 {
+		limit = query.Count
+	}
+	if query.Page > 1 {
+		offset = (query.Page - 1) * limit
+	}
+	q := micro.Query{Raw: "SELECT * FROM " + EmailOutboxTable + " WHERE tenant_id = ?", Args: []any{ctx.TenantId}}
+	if query.Status != "" {
+		q.Raw += " AND status = ?"
+		q.Args = append(q.Args, query.Status)
+	}
+	q.Raw += " ORDER BY created_at DESC LIMIT ? OFFSET ?"
+	q.Args = append(q.Args, limit, offset)
+	if err := ctx.DB().Find(&data, q); err != nil {
+		return schema.EntityList[OutboxEmail]{}, err
+	}
+	return schema.EntityList[OutboxEmail]{Data: data, Page: query.Page}, nil
+}
+
+// Get returns an email of the context tenant by id or message key
+func (m *QueuedMailer) Get(ctx micro.Ctx, idOrKey string) (*OutboxEmail, error) {
+	var record OutboxEmail
+	found, err := ctx.DB().First(&record, micro.Query{
+		W:    "tenant_id = ? AND (id = ? OR message_key = ?)",
+		Args: []any{ctx.TenantId, idOrKey, idOrKey},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.ResourceNotFound("email_not_found")
+	}
+	return &record, nil
+}
+
+// Resend queues a failed or bounced email again with a fresh attempts count
+func (m *QueuedMailer) Resend(ctx micro.Ctx, idOrKey string) (*OutboxEmail, error) {
+	record, err := m.Get(ctx, idOrKey)
+	if err != nil {
+		return nil, err
+	}
+	if record.Status != EmailFailed && record.Status != EmailBounced {
+		return nil, errors.Conflict("email_not_resendable", record.Status)
+	}
+	now := dates.Now()
+	if _, err = ctx.DB().Patch(&OutboxEmail{}, record.Id, map[string]interface{}{
+		"status":          EmailQueued,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"updated_at":      now,
+	}); err != nil {
+		return nil, err
+	}
+	return m.Get(ctx, record.Id)
+}
+
+// MarkBounced records a bounce reported by the provider (usually from a webhook)
+func (m *QueuedMailer) MarkBounced(ctx micro.Ctx, idOrKey string, reason string) error {
+	record, err := m.Get(ctx, idOrKey)
+	if err != nil {
+		return err
+	}
+	_, err = ctx.DB().Patch(&OutboxEmail{}, record.Id, map[string]interface{}{
+		"status":          EmailBounced,
+		"last_error":      reason,
+		"next_attempt_at": nil,
+		"updated_at":      dates.Now(),
+	})
+	return err
+}
+
+// RegisterRoutes exposes:
+//
+//	GET  /          list the emails, filtered by ?status=
+//	GET  /:id       get an email by id or message key
+//	POST /:id/resend queue an email again
+//
+// The filters must restrict them to the administrators.
+func (m *QueuedMailer) RegisterRoutes(router micro.BaseRouter, filters ...micro.MiddlewareFunc) {
+	if len(filters) == 0 {
+		log.Fatalf("email outbox routes require filters restricting them to the administrators")
+	}
+	router.GET("", func(ctx micro.Ctx, query OutboxQuery) (any, error) {
+		return m.List(ctx, query)
+	}, filters...)
+	router.GET("/:id", func(ctx micro.Ctx, input schema.IdModel) (any, error) {
+		return m.Get(ctx, *input.Id)
+	}, filters...)
+	router.POST("/:id/resend", func(ctx micro.Ctx, input schema.IdModel) (any, error) {
+		return m.Resend(ctx, *input.Id)
+	}, filters...)
+}
@@ -0,0 +1,185 @@
+package adapters_test
+
+import (
+	"errors"
+	"github.com/qoalis/go-micro/adapters"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/middleware"
+	"github.com/qoalis/go-micro/schema"
+	"github.com/qoalis/go-micro/tests"
+	"github.com/qoalis/go-micro/util/dates"
+	microerrors "github.com/qoalis/go-micro/util/errors"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type flakyMailer struct {
+	micro.Mailer
+	next     micro.Mailer
+	failures int
+}
+
+func (m *flakyMailer) Send(ctx micro.Ctx, message micro.Email) error {
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("provider unavailable")
+	}
+	return m.next.Send(ctx, message)
+}
+
+func TestEmailOutbox(t *testing.T) {
+	clock := dates.NewFakeClock()
+	// both tenants share the same database
+	db := adapters.NewGormAdapter("file:"+filepath.Join(t.TempDir(), "outbox.db"), micro.DefaultTenantId)
+	env := &micro.Env{
+		TenantLoader: micro.NewFixedTenantLoader([]string{micro.DefaultTenantId, "acme"}),
+		DataSources:  map[string]micro.DataSource{micro.DefaultTenantId: db, "acme": db},
+	}
+	env.UseClock(clock)
+	t.Cleanup(func() { env.UseClock(nil) })
+	env.Scheduler = adapters.NewGoCronAdapter(env, env.TenantLoader)
+	fake := adapters.NewFakeEmailSender()
+	env.Mailer = &flakyMailer{next: fake, failures: 1}
+	adapters.EmailOutbox(adapters.EmailOutboxConfig{Interval: "10s", Backoff: time.Minute}).Configure(&micro.App{Env: env})
+
+	mailer := env.Mailer.(*adapters.QueuedMailer)
+	ctx := micro.NewCtx(env, micro.DefaultTenantId)
+	email := micro.Email{
+		From:       &micro.EmailAddress{Address: "noreply@acme.test"},
+		To:         []micro.EmailAddress{{Address: "jane@example.com"}},
+		Subject:    "Welcome",
+		MessageKey: "welcome:jane",
+	}
+	assert.Nil(t, mailer.Send(ctx, email))
+	assert.Nil(t, mailer.Send(ctx, email))
+	assert.Empty(t, fake.Sent())
+
+	// first attempt fails and is retried after the backoff
+	clock.Advance(10 * time.Second)
+	record, err := mailer.Get(ctx, "welcome:jane")
+	assert.Nil(t, err)
+	assert.Equal(t, adapters.EmailQueued, record.Status)
+	assert.Equal(t, 1, record.Attempts)
+	assert.Equal(t, "provider unavailable", *record.LastError)
+	assert.Empty(t, fake.Sent())
+
+	clock.Advance(time.Minute)
+	assert.Len(t, fake.Sent(), 1)
+	record, _ = mailer.Get(ctx, "welcome:jane")
+	assert.Equal(t, adapters.EmailSent, record.Status)
+
+	// only failed and bounced emails can be resent
+	_, err = mailer.Resend(ctx, record.Id)
+	assert.True(t, errors.As(err, new(*microerrors.ConflictError)))
+
+	// the emails of the other tenants are not visible, their message keys do not collide
+	acme := micro.NewCtx(env, "acme")
+	_, err = mailer.Get(acme, "welcome:jane")
+	assert.True(t, errors.As(err, new(*microerrors.ResourceNotFoundError)))
+	assert.Nil(t, mailer.Send(acme, email))
+	list, err := mailer.List(acme, adapters.OutboxQuery{})
+	assert.Nil(t, err)
+	assert.Len(t, list.Data, 1)
+	assert.Equal(t, "acme", list.Data[0].TenantId)
+	assert.Nil(t, mailer.Flush(acme))
+	assert.Len(t, fake.Sent(), 2)
+
+	// a bounced email can be resent
+	assert.Nil(t, mailer.MarkBounced(ctx, "welcome:jane", "mailbox full"))
+	list, err = mailer.List(ctx, adapters.OutboxQuery{Status: adapters.EmailBounced})
+	assert.Nil(t, err)
+	assert.Len(t, list.Data, 1)
+	_, err = mailer.Resend(ctx, record.Id)
+	assert.Nil(t, err)
+	clock.Advance(10 * time.Second)
+	assert.Len(t, fake.Sent(), 3)
+
+	// the list is paged, most recent first
+	clock.Advance(time.Second)
+	assert.Nil(t, mailer.Send(ctx, micro.Email{To: []micro.EmailAddress{{Address: "john@example.com"}}, MessageKey: "welcome:john"}))
+	first, err := mailer.List(ctx, adapters.OutboxQuery{PagingInput: schema.PagingInput{Page: 1, Count: 1}})
+	assert.Nil(t, err)
+	second, err := mailer.List(ctx, adapters.OutboxQuery{PagingInput: schema.PagingInput{Page: 2, Count: 1}})
+	assert.Nil(t, err)
+	assert.Equal(t, "welcome:john", first.Data[0].MessageKey)
+	assert.Equal(t, "welcome:jane", second.Data[0].MessageKey)
+}
+
+// barrierDataSource holds the workers until all of them have read the due emails, then until all
+// of them have tried to claim them
+type barrierDataSource struct {
+	micro.DataSource
+	reads  sync.WaitGroup
+	claims sync.WaitGroup
+}
+
+func (ds *barrierDataSource) Find(target any, query micro.Query) error {
+	err := ds.DataSource.Find(target, query)
+	ds.reads.Done()
+	ds.reads.Wait()
+	return err
+}
+
+func (ds *barrierDataSource) Raw(query micro.Query) (int64, error) {
+	affected, err := ds.DataSource.Raw(query)
+	if strings.HasPrefix(query.Raw, "UPDATE") {
+		ds.claims.Done()
+		ds.claims.Wait()
+	}
+	return affected, err
+}
+
+func TestEmailOutboxConcurrentFlush(t *testing.T) {
+	db := &barrierDataSource{DataSource: adapters.NewGormAdapter("file:"+filepath.Join(t.TempDir(), "outbox.db"), micro.DefaultTenantId)}
+	env := &micro.Env{
+		TenantLoader: micro.NewFixedTenantLoader([]string{micro.DefaultTenantId}),
+		DataSources:  map[string]micro.DataSource{micro.DefaultTenantId: db},
+	}
+	env.Scheduler = adapters.NewGoCronAdapter(env, env.TenantLoader)
+	fake := adapters.NewFakeEmailSender()
+	env.Mailer = fake
+	adapters.EmailOutbox(adapters.EmailOutboxConfig{Interval: "10s"}).Configure(&micro.App{Env: env})
+	mailer := env.Mailer.(*adapters.QueuedMailer)
+	ctx := micro.NewCtx(env, micro.DefaultTenantId)
+	assert.Nil(t, mailer.Send(ctx, micro.Email{To: []micro.EmailAddress{{Address: "jane@example.com"}}, Subject: "Welcome"}))
+
+	// both workers read the due email, a single one claims and sends it
+	db.reads.Add(2)
+	db.claims.Add(2)
+	var done sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			assert.Nil(t, mailer.Flush(ctx))
+		}()
+	}
+	done.Wait()
+	assert.Len(t, fake.Sent(), 1)
+}
+
+func TestEmailOutboxRoutes(t *testing.T) {
+	t.Setenv(micro.ServerToken, "secret")
+	t.Setenv(micro.DatabaseUrl, "file:"+filepath.Join(t.TempDir(), "outbox.db"))
+	t.Setenv(micro.EmailSender, "fake://")
+	app := adapters.NewApp("outbox", "1.0", micro.Cfg{})
+	app.Init([]micro.Feature{adapters.EmailOutbox(adapters.EmailOutboxConfig{
+		Routes:  "/admin/emails",
+		Filters: []micro.MiddlewareFunc{middleware.Admin()},
+	})})
+	ctx := micro.NewCtx(app.Env, micro.DefaultTenantId)
+	assert.Nil(t, app.Env.Mailer.Send(ctx, micro.Email{To: []micro.EmailAddress{{Address: "jane@example.com"}}, MessageKey: "welcome:jane"}))
+
+	// the recipients and the resend endpoint are only exposed to the administrators
+	f := tests.HttpTestApp(t, app, nil)
+	f.GET("/admin/emails").Expect().IsUnauthorized()
+	f.AsUser("user_1", nil, nil, "").GET("/admin/emails/welcome:jane").Expect().IsForbidden()
+	f.AsUser("user_1", nil, nil, "").POST("/admin/emails/welcome:jane/resend").Expect().IsForbidden()
+	admin := f.AsUser("admin_1", []string{"admin"}, nil, "")
+	admin.GET("/admin/emails").Expect().IsOK().JSON().Path("$.data").Array().Length().IsEqual(1)
+	admin.GET("/admin/emails/welcome:jane").Expect().IsOK().JSON().Path("$.recipients").String().IsEqual("jane@example.com")
+}
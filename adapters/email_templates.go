@@ -0,0 +1,211 @@
+package adapters
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/h"
+	log "github.com/sirupsen/logrus"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// EmailTemplatesFolder is the folder of Cfg.FS holding the email templates
+const EmailTemplatesFolder = "emails"
+
+// EmailTemplates renders emails from local files:
+//
+//	<id>.html     html/template body
+//	<id>.txt      text/template body
+//	<id>.subject  text/template subject (optional)
+//
+// A localized variant in <locale>/<id>.* takes precedence. Templates can translate messages
+// of the locales bundle with {{ t "message_id" }}.
+type EmailTemplates struct {
+	fs            fs.FS
+	bundle        *i18n.Bundle
+	defaultLocale string
+}
+
+type RenderedEmail struct {
+	Subject string
+	Html    string
+	Text    string
+}
+
+func NewEmailTemplates(fsys fs.FS, bundle *i18n.Bundle, defaultLocale string) *EmailTemplates {
+	return &EmailTemplates{fs: fsys, bundle: bundle, defaultLocale: defaultLocale}
+}
+
+// Has tells whether a html or text template exists for the template id
+func (t *EmailTemplates) Has(templateId string, locale string) bool {
+	if templateId == "" {
+		return false
+	}
+	for _, ext := range []string{".html", ".txt"} {
+		if _, ok := t.lookup(templateId+ext, locale); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *EmailTemplates) Render(message micro.Email) (RenderedEmail, error) {
+	var result RenderedEmail
+	locale := message.Locale
+	if locale == "" {
+		locale = t.defaultLocale
+	}
+	funcs := t.funcs(locale, message.TemplateData)
+
+	if file, ok := t.lookup(message.TemplateId+".html", locale); ok {
+		tpl, err := htmltemplate.New(path.Base(file)).Funcs(funcs).ParseFS(t.fs, file)
+		if err != nil {
+			return result, err
+		}
+		var out bytes.Buffer
+		if err = tpl.Execute(&out, message.TemplateData); err != nil {
+			return result, err
+		}
+		result.Html = out.String()
+	}
+	if file, ok := t.lookup(message.TemplateId+".txt", locale); ok {
+		text, err := t.renderText(file, funcs, message.TemplateData)
+		if err != nil {
+			return result, err
+		}
+		result.Text = text
+	}
+	if result.Html == "" && result.Text == "" {
+		return result, fmt.Errorf("email template not found: %s", message.TemplateId)
+	}
+	result.Subject = message.Subject
+	if file, ok := t.lookup(message.TemplateId+".subject", locale); ok {
+		subject, err := t.renderText(file, funcs, message.TemplateData)
+		if err != nil {
+			return result, err
+		}
+		result.Subject = strings.TrimSpace(subject)
+	}
+	return result, nil
+}
+
+func (t *EmailTemplates) renderText(file string, funcs map[string]any, data h.Map) (string, error) {
+	tpl, err := texttemplate.New(path.Base(file)).Funcs(funcs).ParseFS(t.fs, file)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err = tpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func (t *EmailTemplates) lookup(name string, locale string) (string, bool) {
+	candidates := []string{name}
+	if locale != "" {
+		candidates = []string{path.Join(locale, name), name}
+	}
+	for _, candidate := range candidates {
+		if _, err := fs.Stat(t.fs, candidate); err == nil {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+func (t *EmailTemplates) funcs(locale string, data h.Map) map[string]any {
+	var localizer *i18n.Localizer
+	if t.bundle != nil {
+		localizer = i18n.NewLocalizer(t.bundle, locale, t.defaultLocale)
+	}
+	return map[string]any{
+		"t": func(messageId string, args ...any) string {
+			if localizer == nil {
+				return messageId
+			}
+			templateData := any(data)
+			if len(args) > 0 {
+				templateData = args[0]
+			}
+			value, err := localizer.Localize(&i18n.LocalizeConfig{MessageID: messageId, TemplateData: templateData})
+			if err != nil {
+				log.Warnf("email template: missing translation %s for %s", messageId, locale)
+				return messageId
+			}
+			return value
+		},
+	}
+}
+
+// =================================================================================
+// TEMPLATED MAILER
+// =================================================================================
+
+// TemplatedMailer renders emails whose TemplateId matches a local template before handing them
+// to the underlying mailer. Other emails are passed through untouched.
+type TemplatedMailer struct {
+	micro.Mailer
+	next      micro.Mailer
+	templates *EmailTemplates
+}
+
+func NewTemplatedMailer(next micro.Mailer, templates *EmailTemplates) *TemplatedMailer {
+	return &TemplatedMailer{next: next, templates: templates}
+}
+
+func (m *TemplatedMailer) Send(ctx micro.Ctx, message micro.Email) error {
+	rendered, err := m.render(message)
+	if err != nil {
+		return err
+	}
+	return m.next.Send(ctx, rendered)
+}
+
+// Ping probes the underlying mailer when it is a micro.Pinger
+func (m *TemplatedMailer) Ping(ctx context.Context) error {
+	if pinger, ok := m.next.(micro.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (m *TemplatedMailer) SendBatch(ctx micro.Ctx, messages []micro.Email) error {
+	rendered := make([]micro.Email, 0, len(messages))
+	var errs []error
+	for _, message := range messages {
+		out, err := m.render(message)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rendered = append(rendered, out)
+	}
+	if len(rendered) > 0 {
+		errs = append(errs, micro.SendEmails(ctx, m.next, rendered))
+	}
+	return errors.Join(errs...)
+}
+
+func (m *TemplatedMailer) render(message micro.Email) (micro.Email, error) {
+	if !m.templates.Has(message.TemplateId, message.Locale) {
+		return message, nil
+	}
+	rendered, err := m.templates.Render(message)
+	if err != nil {
+		return message, err
+	}
+	message.Subject = rendered.Subject
+	message.Body = ""
+	message.HtmlBody = rendered.Html
+	message.TextBody = rendered.Text
+	message.TemplateId = ""
+	return message, nil
+}
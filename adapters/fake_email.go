@@ -1,12 +1,26 @@
 package adapters
 
 import (
+	"fmt"
 	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/h"
+	"sort"
+	"strings"
+	"sync"
 )
 
+type SentEmail struct {
+	TenantId string
+	Email    micro.Email
+}
+
 type FakeEmailSender struct {
 	micro.Mailer
 	EmailSent int
+	// Templates, when set, are used by Render to preview templated emails
+	Templates *EmailTemplates
+	mu        sync.Mutex
+	sent      []SentEmail
 }
 
 func NewFakeEmailSender() *FakeEmailSender {
@@ -15,7 +29,145 @@ func NewFakeEmailSender() *FakeEmailSender {
 	}
 }
 
-func (s *FakeEmailSender) Send(_ micro.Email) error {
+func (s *FakeEmailSender) Send(ctx micro.Ctx, message micro.Email) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.EmailSent++
+	s.sent = append(s.sent, SentEmail{TenantId: ctx.TenantId, Email: message})
+	return nil
+}
+
+func (s *FakeEmailSender) SendBatch(ctx micro.Ctx, messages []micro.Email) error {
+	for _, message := range messages {
+		if err := s.Send(ctx, message); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// Sent returns a copy of every email recorded so far
+func (s *FakeEmailSender) Sent() []SentEmail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SentEmail{}, s.sent...)
+}
+
+func (s *FakeEmailSender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.EmailSent = 0
+	s.sent = nil
+}
+
+// Render returns a plain text preview of what the email would look like
+func (s *FakeEmailSender) Render(message micro.Email) string {
+	var b strings.Builder
+	if message.From != nil {
+		b.WriteString(fmt.Sprintf("From: %s\n", formatAddress(*message.From)))
+	}
+	b.WriteString(fmt.Sprintf("To: %s\n", formatAddresses(message.To)))
+	if len(message.Cc) > 0 {
+		b.WriteString(fmt.Sprintf("Cc: %s\n", formatAddresses(message.Cc)))
+	}
+	if len(message.Bcc) > 0 {
+		b.WriteString(fmt.Sprintf("Bcc: %s\n", formatAddresses(message.Bcc)))
+	}
+	if message.ReplyTo != nil {
+		b.WriteString(fmt.Sprintf("Reply-To: %s\n", formatAddress(*message.ReplyTo)))
+	}
+	if s.Templates != nil && s.Templates.Has(message.TemplateId, message.Locale) {
+		if rendered, err := s.Templates.Render(message); err == nil {
+			message.Subject = rendered.Subject
+			message.Body, message.HtmlBody, message.TextBody = "", rendered.Html, rendered.Text
+			message.TemplateData = nil
+		}
+	}
+	b.WriteString(fmt.Sprintf("Subject: %s\n", message.Subject))
+	if message.TemplateId != "" {
+		b.WriteString(fmt.Sprintf("Template: %s\n", message.TemplateId))
+		keys := make([]string, 0, len(message.TemplateData))
+		for k := range message.TemplateData {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b.WriteString(fmt.Sprintf("  %s: %v\n", k, message.TemplateData[k]))
+		}
+	}
+	for _, attachment := range message.Attachments {
+		name := attachment.Filename
+		if name == "" && attachment.Upload != nil {
+			name = attachment.Upload.Url
+		}
+		if attachment.Inline {
+			b.WriteString(fmt.Sprintf("Inline: %s\n", name))
+		} else {
+			b.WriteString(fmt.Sprintf("Attachment: %s\n", name))
+		}
+	}
+	body := message.TextBody
+	if body == "" {
+		body = message.Html()
+	}
+	if body != "" {
+		b.WriteString("\n")
+		b.WriteString(body)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func formatAddresses(list []micro.EmailAddress) string {
+	result := make([]string, 0, len(list))
+	for _, addr := range list {
+		result = append(result, formatAddress(addr))
+	}
+	return strings.Join(result, ", ")
+}
+
+func formatAddress(addr micro.EmailAddress) string {
+	if h.IsStrEmpty(addr.Name) {
+		return addr.Address
+	}
+	return fmt.Sprintf("%s <%s>", addr.Name, addr.Address)
+}
+
+// =================================================================================
+// FAKE NOTIFICATIONS
+// =================================================================================
+
+type SentNotification struct {
+	TenantId     string
+	Notification micro.Notification
+}
+
+type FakeNotificationService struct {
+	micro.NotificationService
+	mu   sync.Mutex
+	sent []SentNotification
+}
+
+func NewFakeNotificationService() *FakeNotificationService {
+	return &FakeNotificationService{}
+}
+
+func (s *FakeNotificationService) Send(ctx micro.Ctx, message micro.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, SentNotification{TenantId: ctx.TenantId, Notification: message})
+	return nil
+}
+
+// Sent returns a copy of every notification recorded so far
+func (s *FakeNotificationService) Sent() []SentNotification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SentNotification{}, s.sent...)
+}
+
+func (s *FakeNotificationService) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = nil
+}
@@ -0,0 +1,278 @@
+package adapters
+
+import (
+	"embed"
+	"encoding/json"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/dates"
+	"github.com/qoalis/go-micro/util/errors"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"sync"
+	"time"
+)
+
+//go:embed migrations/feature_flags/*.sql
+var featureFlagsMigrations embed.FS
+
+const (
+	FeatureFlagsTable           = "_feature_flags"
+	FeatureFlagsMigrationsTable = "_feature_flags_version"
+)
+
+type FeatureFlagsConfig struct {
+	// Database stores the flags in the tenant databases, the flags defined by env.Flags (files and
+	// env variables) are used when a tenant does not override them
+	Database bool
+	// CacheTTL is how long the flags of a tenant are kept in memory, defaults to 10s. Changes made
+	// on this instance are visible immediately.
+	CacheTTL time.Duration
+	// Routes, when set, is the path prefix of the endpoints used to inspect and change the flags.
+	// Filters are required with Routes and should restrict these endpoints to administrators.
+	Routes  string
+	Filters []micro.MiddlewareFunc
+}
+
+// FeatureFlagRecord is the persisted definition of a flag
+type FeatureFlagRecord struct {
+	Name       string    `gorm:"primaryKey"`
+	Definition string    `gorm:"type:text"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime:false"`
+}
+
+func (FeatureFlagRecord) TableName() string {
+	return FeatureFlagsTable
+}
+
+type dbFlagsEntry struct {
+	flags   map[string]micro.Flag
+	expires time.Time
+}
+
+// DbFlags is a FlagStore backed by the tenant databases
+type DbFlags struct {
+	micro.FlagStore
+	fallback micro.FlagProvider
+	ttl      time.Duration
+	mu       sync.Mutex
+	tenants  map[string]dbFlagsEntry
+}
+
+// FeatureFlags is a feature exposing the flag admin endpoints and, with Database, replacing
+// env.Flags with a DbFlags
+func FeatureFlags(cfg ...FeatureFlagsConfig) micro.Feature {
+	config := FeatureFlagsConfig{}
+	if len(cfg) > 0 {
+		config = cfg[0]
+	}
+	return micro.Feature{
+		Name: "feature_flags",
+		Configure: func(app *micro.App) {
+			env := app.Env
+			if env.Flags == nil {
+				env.Flags = micro.NewEnvFlags()
+			}
+			if config.Database {
+				if env.DataSources == nil {
+					log.Fatalf("database feature flags require a database, set env.%s", micro.DatabaseUrl)
+				}
+				for _, ds := range env.DataSources {
+					ds.Migrate(featureFlagsMigrations, "migrations/feature_flags", FeatureFlagsMigrationsTable)
+				}
+				env.Flags = NewDbFlags(env.Flags, config.CacheTTL)
+			}
+			if config.Routes != "" && app.Router != nil {
+				RegisterFlagRoutes(app.Router.Group(config.Routes), config.Filters...)
+			}
+		},
+	}
+}
+
+func NewDbFlags(fallback micro.FlagProvider, ttl time.Duration) *DbFlags {
+	if ttl <= 0 {
+		ttl = 10 * time.Second
+	}
+	if fallback == nil {
+		fallback = micro.NewMemoryFlags()
+	}
+	return &DbFlags{fallback: fallback, ttl: ttl, tenants: map[string]dbFlagsEntry{}}
+}
+
+func (d *DbFlags) Flag(ctx micro.Ctx, name string) (*micro.Flag, error) {
+	flags, err := d.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if flag, ok := flags[name]; ok {
+		return &flag, nil
+	}
+	return d.fallback.Flag(ctx, name)
+}
+
+func (d *DbFlags) Flags(ctx micro.Ctx) ([]micro.Flag, error) {
+	defaults, err := d.fallback.Flags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := d.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	merged := map[string]micro.Flag{}
+	for _, flag := range defaults {
+		merged[flag.Name] = flag
+	}
+	for name, flag := range overrides {
+		merged[name] = flag
+	}
+	flags := make([]micro.Flag, 0, len(merged))
+	for _, flag := range merged {
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags, nil
+}
+
+// SaveFlag stores the flag in the tenant database and publishes a micro.FlagChangedTopic event
+func (d *DbFlags) SaveFlag(ctx micro.Ctx, flag micro.Flag) error {
+	db := ctx.DB()
+	if db == nil {
+		return errors.Technical("feature flags: no db found in current context")
+	}
+	definition, err := json.Marshal(flag)
+	if err != nil {
+		return err
+	}
+	if _, err = db.Raw(micro.Query{
+		Raw: "INSERT INTO " + FeatureFlagsTable + " (name, definition, updated_at) VALUES (?, ?, ?) " +
+			"ON CONFLICT (name) DO UPDATE SET definition = excluded.definition, updated_at = excluded.updated_at",
+		Args: []any{flag.Name, string(definition), dates.Now()},
+	}); err != nil {
+		return err
+	}
+	d.Invalidate(ctx.TenantId)
+	micro.PublishFlagChange(ctx, "saved", flag)
+	return nil
+}
+
+// DeleteFlag removes the tenant override, the default flag applies again if there is one
+func (d *DbFlags) DeleteFlag(ctx micro.Ctx, name string) error {
+	db := ctx.DB()
+	if db == nil {
+		return errors.Technical("feature flags: no db found in current context")
+	}
+	deleted, err := db.Delete(&FeatureFlagRecord{}, micro.Query{W: "name = ?", Args: []any{name}})
+	if err != nil {
+		return err
+	}
+	d.Invalidate(ctx.TenantId)
+	if deleted > 0 {
+		micro.PublishFlagChange(ctx, "deleted", micro.Flag{Name: name})
+	}
+	return nil
+}
+
+// Invalidate drops the cached flags of the tenant
+func (d *DbFlags) Invalidate(tenant string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.tenants, tenant)
+}
+
+func (d *DbFlags) load(ctx micro.Ctx) (map[string]micro.Flag, error) {
+	d.mu.Lock()
+	entry, ok := d.tenants[ctx.TenantId]
+	d.mu.Unlock()
+	if ok && dates.Now().Before(entry.expires) {
+		return entry.flags, nil
+	}
+	db := ctx.DB()
+	if db == nil {
+		return nil, nil
+	}
+	var records []FeatureFlagRecord
+	if err := db.FindAll(&records); err != nil {
+		return nil, err
+	}
+	flags := make(map[string]micro.Flag, len(records))
+	for _, record := range records {
+		var flag micro.Flag
+		if err := json.Unmarshal([]byte(record.Definition), &flag); err != nil {
+			log.Errorf("invalid definition of flag %s -- %v", record.Name, err)
+			continue
+		}
+		flag.Name = record.Name
+		flags[record.Name] = flag
+	}
+	d.mu.Lock()
+	d.tenants[ctx.TenantId] = dbFlagsEntry{flags: flags, expires: dates.Now().Add(d.ttl)}
+	d.mu.Unlock()
+	return flags, nil
+}
+
+// =================================================================================
+// ROUTES
+// =================================================================================
+
+type flagInput struct {
+	Name string `param:"name" validate:"required"`
+	micro.Flag
+}
+
+type flagNameInput struct {
+	Name string `param:"name" validate:"required"`
+}
+
+// RegisterFlagRoutes exposes:
+//
+//	GET    /       list the flags with their value for the caller
+//	GET    /:name  get a flag
+//	PUT    /:name  create or replace a flag, env.Flags must be a micro.FlagStore
+//	DELETE /:name  delete a flag
+//
+// The filters are applied to every endpoint, they are required since the flags can be changed.
+func RegisterFlagRoutes(router micro.BaseRouter, filters ...micro.MiddlewareFunc) {
+	if len(filters) == 0 {
+		log.Fatalf("feature flag routes require filters restricting them to the administrators")
+	}
+	router.GET("", func(ctx micro.Ctx) (any, error) {
+		flags, err := ctx.Env.Flags.Flags(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result := make([]map[string]any, 0, len(flags))
+		for _, flag := range flags {
+			result = append(result, map[string]any{"flag": flag, "value": flag.Evaluate(ctx)})
+		}
+		return result, nil
+	}, filters...)
+	router.GET("/:name", func(ctx micro.Ctx, input flagNameInput) (any, error) {
+		flag, err := ctx.Env.Flags.Flag(ctx, input.Name)
+		if err != nil {
+			return nil, err
+		}
+		if flag == nil {
+			return nil, errors.ResourceNotFound("flag_not_found")
+		}
+		return flag, nil
+	}, filters...)
+	router.PUT("/:name", func(ctx micro.Ctx, input flagInput) (any, error) {
+		store, ok := ctx.Env.Flags.(micro.FlagStore)
+		if !ok {
+			return nil, errors.Functional("flags_read_only")
+		}
+		flag := input.Flag
+		flag.Name = input.Name
+		if err := store.SaveFlag(ctx, flag); err != nil {
+			return nil, err
+		}
+		return flag, nil
+	}, filters...)
+	router.DELETE("/:name", func(ctx micro.Ctx, input flagNameInput) (any, error) {
+		store, ok := ctx.Env.Flags.(micro.FlagStore)
+		if !ok {
+			return nil, errors.Functional("flags_read_only")
+		}
+		return nil, store.DeleteFlag(ctx, input.Name)
+	}, filters...)
+}
@@ -0,0 +1,58 @@
+package adapters_test
+
+import (
+	"github.com/qoalis/go-micro/adapters"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/middleware"
+	"github.com/qoalis/go-micro/tests"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	t.Setenv(micro.ServerToken, "secret")
+	t.Setenv(micro.DatabaseUrl, "file:"+filepath.Join(t.TempDir(), "flags.db"))
+	t.Setenv("FLAG_NEW_CHECKOUT", "false")
+	t.Setenv("FLAG_THEME", "dark")
+	micro.SetSyncDelivery(true)
+	t.Cleanup(func() { micro.SetSyncDelivery(false) })
+
+	app := adapters.NewApp("flags", "1.0", micro.Cfg{})
+	app.Init([]micro.Feature{adapters.FeatureFlags(adapters.FeatureFlagsConfig{
+		Database: true,
+		Routes:   "/admin/flags",
+		Filters:  []micro.MiddlewareFunc{middleware.Admin()},
+	})})
+
+	var changes []string
+	assert.Nil(t, micro.Subscribe(micro.FlagChangedTopic, func(_ micro.Ctx, event micro.Event) error {
+		changes = append(changes, event.Subject+":"+event.Event)
+		return nil
+	}))
+
+	app.Router.GET("/checkout", func(ctx micro.Ctx) (any, error) {
+		return map[string]any{"theme": ctx.Flag("theme").Variant}, nil
+	}, middleware.FlagEnabled("new_checkout"))
+
+	f := tests.HttpTestApp(t, app, nil)
+	admin := f.AsUser("admin_1", []string{"admin"}, nil, "")
+	f.GET("/checkout").Expect().IsNotFound()
+
+	// the tenant override enables the flag for admins only
+	override := micro.Flag{Enabled: true, Rules: []micro.FlagRule{{Roles: []string{"admin"}}}}
+	f.PUT("/admin/flags/new_checkout", override).Expect().IsUnauthorized()
+	f.AsUser("user_1", nil, nil, "").PUT("/admin/flags/new_checkout", override).Expect().IsForbidden()
+	admin.PUT("/admin/flags/new_checkout", override).Expect().IsOK()
+	assert.Equal(t, []string{"new_checkout:saved"}, changes)
+
+	f.GET("/checkout").Expect().IsNotFound()
+	f.AsUser("user_1", []string{"admin"}, nil, "").GET("/checkout").Expect().IsOK().
+		JSON().Object().Path("$.theme").String().IsEqual("dark")
+
+	admin.GET("/admin/flags/new_checkout").Expect().IsOK().JSON().Object().Path("$.enabled").Boolean().IsTrue()
+	admin.DELETE("/admin/flags/new_checkout").Expect().IsOK()
+	admin.GET("/admin/flags/new_checkout").Expect().IsOK().JSON().Object().Path("$.enabled").Boolean().IsFalse()
+	admin.GET("/admin/flags/unknown").Expect().IsNotFound()
+	assert.Equal(t, []string{"new_checkout:saved", "new_checkout:deleted"}, changes)
+}
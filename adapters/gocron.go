@@ -1,9 +1,13 @@
 package adapters
 
 import (
+	"context"
+	"fmt"
 	"github.com/go-co-op/gocron"
 	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/dates"
 	log "github.com/sirupsen/logrus"
+	"sync"
 	"time"
 )
 
@@ -14,6 +18,19 @@ type GoCronSchedulingAdapter struct {
 	tenantLoader micro.TenantLoader
 	empty        bool
 	env          *micro.Env
+	// mu guards stopped and the additions to running so that no job starts once Stop waits
+	mu      sync.Mutex
+	running sync.WaitGroup
+	stopped bool
+	jobs    []*scheduledJob
+}
+
+// scheduledJob is run by gocron, or by the fake clock it is attached to while that clock is in use
+type scheduledJob struct {
+	interval time.Duration
+	limit    int
+	run      func() error
+	clock    *dates.FakeClock
 }
 
 func NewGoCronAdapter(env *micro.Env, tenantLoader micro.TenantLoader) micro.Scheduler {
@@ -31,9 +48,32 @@ func (s *GoCronSchedulingAdapter) IsEmpty() bool {
 }
 
 func (s *GoCronSchedulingAdapter) StartAsync() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
 	s.internal.StartAsync()
 }
 
+func (s *GoCronSchedulingAdapter) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.internal.Stop()
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scheduler jobs still running -- %w", ctx.Err())
+	}
+}
+
 func (s *GoCronSchedulingAdapter) Every(interval string, handler micro.SchedulerHandler) {
 	s.schedule(interval, 0, handler)
 }
@@ -50,8 +90,41 @@ func (s *GoCronSchedulingAdapter) OncePerTenant(handler micro.SchedulerHandler)
 	s.schedule("5s", 1, handler, s.tenantLoader.GetTenant()...)
 }
 
+// UseClock attaches the jobs to a fake clock so that the tests fire them with Advance
+func (s *GoCronSchedulingAdapter) UseClock(clock dates.Clock) {
+	fake, ok := clock.(*dates.FakeClock)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		job.attach(fake)
+	}
+}
+
+func (j *scheduledJob) attach(clock *dates.FakeClock) {
+	if j.clock == clock {
+		return
+	}
+	j.clock = clock
+	clock.Every(j.interval, j.limit, func() {
+		if dates.CurrentClock() == dates.Clock(clock) {
+			_ = j.run()
+		}
+	})
+}
+
 func (s *GoCronSchedulingAdapter) schedule(interval string, limit int, handler func(ctx micro.Ctx) error, tenants ...string) {
-	sched, err := s.internal.Every(interval).Do(func() error {
+	job := func() error {
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			return nil
+		}
+		s.running.Add(1)
+		s.mu.Unlock()
+		defer s.running.Done()
 		defer func() {
 			if err := recover(); err != nil {
 				log.Error(err)
@@ -73,13 +146,31 @@ func (s *GoCronSchedulingAdapter) schedule(interval string, limit int, handler f
 			}
 			return nil
 		}
+	}
+
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scheduled := &scheduledJob{interval: d, limit: limit, run: job}
+	// the clock is checked when the job runs: gocron leaves the jobs to a fake clock in use
+	sched, err := s.internal.Every(interval).Do(func() error {
+		if _, fake := dates.CurrentClock().(*dates.FakeClock); fake {
+			return nil
+		}
+		return job()
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
 	if limit > 0 {
 		sched.LimitRunsTo(limit)
 	}
-	if err != nil {
-		log.Fatal(err)
-	} else {
-		s.empty = false
+	s.mu.Lock()
+	s.jobs = append(s.jobs, scheduled)
+	if clock, ok := dates.CurrentClock().(*dates.FakeClock); ok {
+		scheduled.attach(clock)
 	}
+	s.mu.Unlock()
+	s.empty = false
 }
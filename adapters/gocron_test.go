@@ -0,0 +1,60 @@
+package adapters_test
+
+import (
+	"context"
+	"github.com/qoalis/go-micro/adapters"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/dates"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSchedulerFakeClock(t *testing.T) {
+	env := &micro.Env{TenantLoader: micro.NewFixedTenantLoader([]string{micro.DefaultTenantId, "acme"})}
+	env.Scheduler = adapters.NewGoCronAdapter(env, env.TenantLoader)
+	var mu sync.Mutex
+	var runs []string
+	record := func(name string) micro.SchedulerHandler {
+		return func(ctx micro.Ctx) error {
+			mu.Lock()
+			defer mu.Unlock()
+			runs = append(runs, name+"@"+ctx.TenantId)
+			return nil
+		}
+	}
+	taken := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		result := runs
+		runs = nil
+		return result
+	}
+
+	// the jobs are scheduled before the fake clock is installed
+	env.Scheduler.Every("1m", record("sync"))
+	env.Scheduler.OncePerTenant(record("init"))
+	clock := dates.NewFakeClock()
+	env.UseClock(clock)
+	t.Cleanup(func() { env.UseClock(nil) })
+	env.Scheduler.EveryTenant("10m", record("report"))
+	assert.False(t, env.Scheduler.IsEmpty())
+
+	clock.Advance(0)
+	assert.Equal(t, []string{"sync@public", "init@public", "init@acme", "report@public", "report@acme"}, taken())
+	clock.Advance(time.Minute)
+	assert.Equal(t, []string{"sync@public"}, taken())
+	clock.Advance(9 * time.Minute)
+	assert.Len(t, taken(), 11)
+
+	// the jobs follow the clock in use when they run
+	env.UseClock(nil)
+	clock.Advance(time.Hour)
+	assert.Empty(t, taken())
+
+	env.UseClock(clock)
+	assert.Nil(t, env.Scheduler.Stop(context.Background()))
+	clock.Advance(time.Hour)
+	assert.Empty(t, taken())
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/onrik/gorm-logrus"
 	"github.com/pressly/goose/v3"
 	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/dates"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
@@ -207,7 +208,8 @@ func createLink(url string, dbschema string) *gorm.DB {
 	}
 
 	gdb, err := gorm.Open(dialector, &gorm.Config{
-		Logger: gorm_logrus.New(),
+		Logger:  gorm_logrus.New(),
+		NowFunc: dates.Now,
 	})
 
 	if err == nil && supportSchema && dbschema != "" {
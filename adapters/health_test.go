@@ -0,0 +1,63 @@
+package adapters_test
+
+import (
+	"context"
+	"errors"
+	"github.com/qoalis/go-micro/adapters"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/tests"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthProbes(t *testing.T) {
+	smtpServer := tests.NewSmtpServer(t)
+	t.Setenv(micro.DatabaseUrl, "file:"+filepath.Join(t.TempDir(), "health.db"))
+	t.Setenv(micro.EmailSender, smtpServer.Url())
+
+	app := adapters.NewApp("health", "1.0", micro.Cfg{})
+	app.Init(nil)
+	var calls atomic.Int32
+	var broken atomic.Bool
+	app.AddHealthCheck(micro.HealthCheck{Name: "billing", Check: func(ctx context.Context) error {
+		calls.Add(1)
+		if broken.Load() {
+			return errors.New("billing api unreachable")
+		}
+		return nil
+	}})
+	app.AddHealthCheck(micro.HealthCheck{Name: "search", Optional: true, Timeout: 20 * time.Millisecond, Check: func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}})
+
+	// the errors of the components are only shown to the operators
+	app.Env.Health = micro.NewHealthProbe(app.Env, micro.HealthConfig{DetailsAllowed: func(r *http.Request) bool {
+		return r.Header.Get("X-Health-Token") == "operator"
+	}})
+
+	f := tests.HttpTestApp(t, app, nil)
+	f.GET("/health/live").Expect().IsOK().JSON().Object().Path("$.status").String().IsEqual("UP")
+
+	f.GET("/health/ready").Expect().IsOK().JSON().Object().Path("$.components.search").Object().NotContainsKey("details")
+	status := f.GET("/health/ready").Header("X-Health-Token", "operator").Expect().IsOK().JSON().Object()
+	status.Path("$.status").String().IsEqual("UP")
+	status.Path("$.components").Object().ContainsKey("db:public")
+	status.Path("$.components.mailer.status").String().IsEqual("UP")
+	status.Path("$.components.search.status").String().IsEqual("DOWN")
+	status.Path("$.components.search.details").String().IsEqual("timeout after 20ms")
+
+	// results are cached
+	broken.Store(true)
+	f.GET("/health").Expect().IsOK()
+	assert.Equal(t, int32(1), calls.Load())
+
+	app.Env.Health.Invalidate()
+	f.GET("/health/ready").Header("X-Health-Token", "operator").Expect().Status(503).JSON().Object().
+		Path("$.components.billing.details").String().IsEqual("billing api unreachable")
+	f.GET("/health/live").Expect().IsOK()
+}
@@ -0,0 +1,53 @@
+package adapters
+
+import (
+	"errors"
+	"github.com/qoalis/go-micro/micro"
+	log "github.com/sirupsen/logrus"
+	"net/mail"
+	"net/url"
+)
+
+// mailerFrom returns the sender of the message, falling back to the mailer default
+func mailerFrom(message micro.Email, fallback *micro.EmailAddress) (*micro.EmailAddress, error) {
+	if message.From != nil {
+		return message.From, nil
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, errors.New("email sender is missing")
+}
+
+// parseMailerFrom reads the default sender from the ?from= parameter of a mailer url
+func parseMailerFrom(query url.Values) (*micro.EmailAddress, error) {
+	from := query.Get("from")
+	if from == "" {
+		return nil, nil
+	}
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, err
+	}
+	return &micro.EmailAddress{Name: addr.Name, Address: addr.Address}, nil
+}
+
+// sendEach sends the messages one by one and reports every failure
+func sendEach(ctx micro.Ctx, mailer micro.Mailer, messages []micro.Email) error {
+	var errs []error
+	for _, message := range messages {
+		if err := mailer.Send(ctx, message); err != nil {
+			log.Error(err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func addressList(list []micro.EmailAddress) []string {
+	result := make([]string, 0, len(list))
+	for _, addr := range list {
+		result = append(result, mimeAddress(addr))
+	}
+	return result
+}
@@ -0,0 +1,127 @@
+package adapters
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/go-resty/resty/v2"
+	"github.com/qoalis/go-micro/micro"
+	log "github.com/sirupsen/logrus"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const MailgunDefaultBaseUrl = "https://api.mailgun.net"
+
+type MailgunConfig struct {
+	ApiKey string
+	Domain string
+	// BaseUrl defaults to the US region, use https://api.eu.mailgun.net for the EU one
+	BaseUrl string
+	From    *micro.EmailAddress
+}
+
+type MailgunEmailSender struct {
+	micro.Mailer
+	cfg    MailgunConfig
+	client *resty.Client
+}
+
+type mailgunErrorResponse struct {
+	Message string `json:"message"`
+}
+
+// ParseMailgunUrl parses mailgun://<api_key>@<domain>?base_url=https://api.eu.mailgun.net&from=noreply@example.com
+func ParseMailgunUrl(value string) (MailgunConfig, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return MailgunConfig{}, err
+	}
+	cfg := MailgunConfig{
+		ApiKey:  u.User.Username(),
+		Domain:  u.Host,
+		BaseUrl: u.Query().Get("base_url"),
+	}
+	if cfg.From, err = parseMailerFrom(u.Query()); err != nil {
+		return cfg, err
+	}
+	if cfg.ApiKey == "" || cfg.Domain == "" {
+		return cfg, errors.New("mailgun api key or domain is missing")
+	}
+	return cfg, nil
+}
+
+func NewMailgunEmailSender(cfg MailgunConfig) *MailgunEmailSender {
+	if cfg.BaseUrl == "" {
+		cfg.BaseUrl = MailgunDefaultBaseUrl
+	}
+	return &MailgunEmailSender{
+		cfg:    cfg,
+		client: resty.New().SetTimeout(30*time.Second).SetBasicAuth("api", cfg.ApiKey),
+	}
+}
+
+func (s *MailgunEmailSender) Send(_ micro.Ctx, message micro.Email) error {
+	from, err := mailerFrom(message, s.cfg.From)
+	if err != nil {
+		return err
+	}
+	attachments, err := message.LoadAttachments()
+	if err != nil {
+		return err
+	}
+	form := url.Values{}
+	form.Set("from", mimeAddress(*from))
+	form["to"] = addressList(message.To)
+	form["cc"] = addressList(message.Cc)
+	form["bcc"] = addressList(message.Bcc)
+	form.Set("subject", message.Subject)
+	if html := message.Html(); html != "" {
+		form.Set("html", html)
+	}
+	if message.TextBody != "" {
+		form.Set("text", message.TextBody)
+	}
+	if message.ReplyTo != nil {
+		form.Set("h:Reply-To", mimeAddress(*message.ReplyTo))
+	}
+	for k, v := range message.Headers {
+		form.Set("h:"+k, v)
+	}
+	form["o:tag"] = message.Categories
+	if message.TemplateId != "" {
+		form.Set("template", message.TemplateId)
+		variables, _ := json.Marshal(message.TemplateData)
+		form.Set("t:variables", string(variables))
+	}
+
+	req := s.client.R().SetFormDataFromValues(form)
+	for _, attachment := range attachments {
+		param := "attachment"
+		if attachment.Inline {
+			// mailgun references inline files by their filename
+			param = "inline"
+			attachment.Filename = attachment.ContentId
+		}
+		req.SetMultipartField(param, attachment.Filename, attachment.ContentType, bytes.NewReader(attachment.Content))
+	}
+	res, err := req.Post(s.cfg.BaseUrl + "/v3/" + s.cfg.Domain + "/messages")
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		var body mailgunErrorResponse
+		_ = json.Unmarshal(res.Body(), &body)
+		if body.Message == "" {
+			body.Message = strings.TrimSpace(res.String())
+		}
+		return &micro.MailerError{Provider: "mailgun", StatusCode: res.StatusCode(), Message: body.Message}
+	}
+	log.Infof("Email sent to %v", message.Recipients())
+	return nil
+}
+
+func (s *MailgunEmailSender) SendBatch(ctx micro.Ctx, messages []micro.Email) error {
+	return sendEach(ctx, s, messages)
+}
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS _email_outbox
+(
+    id              VARCHAR(64)  NOT NULL PRIMARY KEY,
+    message_key     VARCHAR(255) NOT NULL,
+    tenant_id       VARCHAR(64)  NOT NULL,
+    status          VARCHAR(16)  NOT NULL,
+    attempts        INTEGER      NOT NULL DEFAULT 0,
+    last_error      TEXT,
+    recipients      TEXT         NOT NULL,
+    subject         TEXT         NOT NULL,
+    payload         TEXT         NOT NULL,
+    next_attempt_at TIMESTAMP,
+    sent_at         TIMESTAMP,
+    created_at      TIMESTAMP    NOT NULL,
+    updated_at      TIMESTAMP    NOT NULL,
+    UNIQUE (tenant_id, message_key)
+);
+CREATE INDEX IF NOT EXISTS idx_email_outbox_due ON _email_outbox (tenant_id, status, next_attempt_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS _email_outbox;
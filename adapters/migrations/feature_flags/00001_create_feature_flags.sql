@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS _feature_flags
+(
+    name       VARCHAR(128) NOT NULL PRIMARY KEY,
+    definition TEXT         NOT NULL,
+    updated_at TIMESTAMP    NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS _feature_flags;
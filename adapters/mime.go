@@ -0,0 +1,192 @@
+package adapters
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/dates"
+	"github.com/qoalis/go-micro/util/ids"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+type mimePart struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+func mimeAddress(addr micro.EmailAddress) string {
+	return (&mail.Address{Name: addr.Name, Address: addr.Address}).String()
+}
+
+func mimeAddresses(list []micro.EmailAddress) string {
+	result := make([]string, 0, len(list))
+	for _, addr := range list {
+		result = append(result, mimeAddress(addr))
+	}
+	return strings.Join(result, ", ")
+}
+
+// buildMimeMessage renders the message as a RFC 5322 document. Bodies are sent as
+// multipart/alternative when both html and text are set, inline attachments are grouped with
+// the bodies in a multipart/related part and the regular ones are added to a multipart/mixed.
+// Bcc recipients are not written, attachments must already be loaded.
+func buildMimeMessage(message micro.Email, attachments []micro.EmailAttachment) ([]byte, error) {
+	if err := checkMimeMessage(message, attachments); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	domain := "localhost"
+	if parts := strings.SplitN(message.From.Address, "@", 2); len(parts) == 2 {
+		domain = parts[1]
+	}
+	b.WriteString("From: " + mimeAddress(*message.From) + "\r\n")
+	b.WriteString("To: " + mimeAddresses(message.To) + "\r\n")
+	if len(message.Cc) > 0 {
+		b.WriteString("Cc: " + mimeAddresses(message.Cc) + "\r\n")
+	}
+	if message.ReplyTo != nil {
+		b.WriteString("Reply-To: " + mimeAddress(*message.ReplyTo) + "\r\n")
+	}
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	b.WriteString("Date: " + dates.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("Message-ID: <" + ids.NewId("") + "@" + domain + ">\r\n")
+	if len(message.Categories) > 0 {
+		b.WriteString("X-Categories: " + strings.Join(message.Categories, ", ") + "\r\n")
+	}
+	keys := make([]string, 0, len(message.Headers))
+	for k := range message.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(textproto.CanonicalMIMEHeaderKey(k) + ": " + mime.QEncoding.Encode("utf-8", message.Headers[k]) + "\r\n")
+	}
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	root := mimeBody(message)
+	var inline, regular []mimePart
+	for _, attachment := range attachments {
+		if attachment.Inline {
+			inline = append(inline, attachmentPart(attachment))
+		} else {
+			regular = append(regular, attachmentPart(attachment))
+		}
+	}
+	if len(inline) > 0 {
+		root = multipartOf("related", append([]mimePart{root}, inline...))
+	}
+	if len(regular) > 0 {
+		root = multipartOf("mixed", append([]mimePart{root}, regular...))
+	}
+	writeMimeHeader(&b, root.header)
+	b.WriteString("\r\n")
+	b.Write(root.body)
+	return b.Bytes(), nil
+}
+
+// checkMimeMessage rejects the values written raw in the headers which would inject other headers:
+// the custom header keys, the categories and the filenames and content ids of the attachments
+func checkMimeMessage(message micro.Email, attachments []micro.EmailAttachment) error {
+	for k := range message.Headers {
+		if k == "" || strings.ContainsAny(k, "\r\n:") {
+			return fmt.Errorf("invalid email header %q", k)
+		}
+	}
+	for _, category := range message.Categories {
+		if strings.ContainsAny(category, "\r\n") {
+			return fmt.Errorf("invalid email category %q", category)
+		}
+	}
+	for _, attachment := range attachments {
+		if strings.ContainsAny(attachment.Filename, "\r\n") {
+			return fmt.Errorf("invalid attachment filename %q", attachment.Filename)
+		}
+		if strings.ContainsAny(attachment.ContentId, "\r\n") {
+			return fmt.Errorf("invalid attachment content id %q", attachment.ContentId)
+		}
+	}
+	return nil
+}
+
+func mimeBody(message micro.Email) mimePart {
+	html, text := message.Html(), message.TextBody
+	switch {
+	case html != "" && text != "":
+		return multipartOf("alternative", []mimePart{textPart("text/plain", text), textPart("text/html", html)})
+	case html != "":
+		return textPart("text/html", html)
+	default:
+		return textPart("text/plain", text)
+	}
+}
+
+func textPart(contentType string, value string) mimePart {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType+"; charset=utf-8")
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	return mimePart{header: header, body: quotedPrintable(value)}
+}
+
+func attachmentPart(attachment micro.EmailAttachment) mimePart {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType(attachment.ContentType, map[string]string{"name": attachment.Filename}))
+	header.Set("Content-Transfer-Encoding", "base64")
+	disposition := "attachment"
+	if attachment.Inline {
+		disposition = "inline"
+		header.Set("Content-ID", "<"+attachment.ContentId+">")
+	}
+	header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+
+	var b bytes.Buffer
+	encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+	return mimePart{header: header, body: b.Bytes()}
+}
+
+func multipartOf(subtype string, parts []mimePart) mimePart {
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	for _, part := range parts {
+		pw, _ := w.CreatePart(part.header)
+		_, _ = pw.Write(part.body)
+	}
+	_ = w.Close()
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", "multipart/"+subtype+"; boundary="+w.Boundary())
+	return mimePart{header: header, body: b.Bytes()}
+}
+
+func writeMimeHeader(b *bytes.Buffer, header textproto.MIMEHeader) {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range header[k] {
+			b.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+}
+
+func quotedPrintable(value string) []byte {
+	var b bytes.Buffer
+	w := quotedprintable.NewWriter(&b)
+	_, _ = w.Write([]byte(value))
+	_ = w.Close()
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
@@ -0,0 +1,63 @@
+package adapters
+
+import (
+	"context"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/h"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var richNotification = micro.Notification{
+	Title:    "Payment failed",
+	Message:  "card declined",
+	Severity: micro.SeverityError,
+	Topic:    "billing",
+	TenantId: "acme",
+	Fields:   []micro.NotificationField{{Name: "Amount", Value: "42 EUR", Inline: true}},
+	Links:    []micro.NotificationLink{{Label: "Invoice", Url: "https://acme.test/invoices/1"}},
+}
+
+func TestDiscordPayload(t *testing.T) {
+	assert.Equal(t, h.Map{"content": "plain"}, discordPayload(micro.Notification{Message: "plain"}))
+
+	embed := discordPayload(richNotification)["embeds"].([]h.Map)[0]
+	assert.Equal(t, "Payment failed", embed["title"])
+	assert.Equal(t, "card declined\n[Invoice](https://acme.test/invoices/1)", embed["description"])
+	assert.Equal(t, 0xe74c3c, embed["color"])
+	assert.Equal(t, []h.Map{{"name": "Amount", "value": "42 EUR", "inline": true}}, embed["fields"])
+	assert.Equal(t, h.Map{"text": "billing · tenant acme"}, embed["footer"])
+}
+
+func TestSlackPayload(t *testing.T) {
+	payload := slackPayload(richNotification)
+	assert.Equal(t, "[ERROR] billing: Payment failed\ncard declined\nAmount: 42 EUR\nInvoice: https://acme.test/invoices/1", payload["text"])
+	blocks := payload["blocks"].([]h.Map)
+	assert.Len(t, blocks, 5)
+	assert.Equal(t, "header", blocks[0]["type"])
+	assert.Equal(t, []h.Map{{"type": "mrkdwn", "text": "*Amount*\n42 EUR"}}, blocks[2]["fields"])
+	assert.Equal(t, h.Map{"type": "mrkdwn", "text": "<https://acme.test/invoices/1|Invoice>"}, blocks[3]["text"])
+}
+
+func TestNotifierErrorsHideSecrets(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	telegram, err := NewTelegramClient("telegram://bot-secret@42?base_url=" + server.URL)
+	assert.Nil(t, err)
+	discord := NewDiscordClient(server.URL + "/api/webhooks/1/webhook-secret")
+	slack := NewSlackClient(server.URL + "/services/T0/B0/webhook-secret")
+	webhook := NewWebhookClient(server.URL + "/hooks/webhook-secret")
+	for _, client := range []micro.NotificationService{telegram, discord, slack, webhook} {
+		if pinger, ok := client.(micro.Pinger); ok {
+			err = pinger.Ping(context.Background())
+			assert.NotNil(t, err)
+			assert.NotContains(t, err.Error(), "secret")
+		}
+		err = client.Send(micro.Ctx{}, micro.Notification{Message: "plain"})
+		assert.NotNil(t, err)
+		assert.NotContains(t, err.Error(), "secret")
+	}
+}
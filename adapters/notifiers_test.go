@@ -0,0 +1,39 @@
+package adapters_test
+
+import (
+	"github.com/qoalis/go-micro/adapters"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestNotificationChannels(t *testing.T) {
+	webhook, webhookRequests := newProviderStub(t, http.StatusOK, `{}`)
+	telegram, telegramRequests := newProviderStub(t, http.StatusOK, `{"ok":true}`)
+	fake := adapters.NewFakeEmailSender()
+	env := &micro.Env{AppName: "billing", Mailer: fake}
+
+	channels, err := adapters.NewNotificationChannels(env, ""+
+		"webhook+"+webhook.URL+"/alerts?topics=billing.*, "+
+		"telegram://123:abc@42?min_severity=warning&base_url="+telegram.URL+", "+
+		"email://ops@acme.test?min_severity=critical&from=noreply@acme.test")
+	assert.Nil(t, err)
+	assert.Len(t, channels, 3)
+	router := micro.NewNotificationRouter(channels...)
+	ctx := micro.NewCtx(env, micro.DefaultTenantId)
+
+	assert.Nil(t, router.Send(ctx, micro.Notification{Message: "invoice paid", Topic: "billing.invoices"}))
+	assert.Len(t, *webhookRequests, 1)
+	assert.Equal(t, "/alerts", (*webhookRequests)[0].Path)
+	assert.Equal(t, "info", (*webhookRequests)[0].Payload["severity"])
+	assert.Empty(t, *telegramRequests)
+
+	assert.Nil(t, router.Send(ctx, micro.Notification{Message: "db down", Severity: micro.SeverityCritical, Topic: "infra"}))
+	assert.Len(t, *webhookRequests, 1)
+	assert.Len(t, *telegramRequests, 1)
+	assert.Equal(t, "/bot123:abc/sendMessage", (*telegramRequests)[0].Path)
+	assert.Equal(t, "[CRITICAL] infra: db down", (*telegramRequests)[0].Payload["text"])
+	assert.Len(t, fake.Sent(), 1)
+	assert.Equal(t, "[billing] infra (CRITICAL)", fake.Sent()[0].Email.Subject)
+}
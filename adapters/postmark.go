@@ -0,0 +1,171 @@
+package adapters
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/go-resty/resty/v2"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/h"
+	log "github.com/sirupsen/logrus"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const PostmarkDefaultBaseUrl = "https://api.postmarkapp.com"
+
+type PostmarkConfig struct {
+	ServerToken string
+	// MessageStream defaults to the outbound transactional stream
+	MessageStream string
+	BaseUrl       string
+	From          *micro.EmailAddress
+}
+
+type PostmarkEmailSender struct {
+	micro.Mailer
+	cfg    PostmarkConfig
+	client *resty.Client
+}
+
+type postmarkHeader struct {
+	Name  string
+	Value string
+}
+
+type postmarkAttachment struct {
+	Name        string
+	Content     string
+	ContentType string
+	ContentID   string `json:",omitempty"`
+}
+
+type postmarkErrorResponse struct {
+	ErrorCode int
+	Message   string
+}
+
+// ParsePostmarkUrl parses postmark://<server_token>?stream=outbound&base_url=...&from=noreply@example.com
+func ParsePostmarkUrl(value string) (PostmarkConfig, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return PostmarkConfig{}, err
+	}
+	cfg := PostmarkConfig{
+		ServerToken:   u.Host,
+		MessageStream: u.Query().Get("stream"),
+		BaseUrl:       u.Query().Get("base_url"),
+	}
+	if cfg.From, err = parseMailerFrom(u.Query()); err != nil {
+		return cfg, err
+	}
+	if cfg.ServerToken == "" {
+		return cfg, errors.New("postmark server token is missing")
+	}
+	return cfg, nil
+}
+
+func NewPostmarkEmailSender(cfg PostmarkConfig) *PostmarkEmailSender {
+	if cfg.BaseUrl == "" {
+		cfg.BaseUrl = PostmarkDefaultBaseUrl
+	}
+	return &PostmarkEmailSender{
+		cfg: cfg,
+		client: resty.New().
+			SetTimeout(30*time.Second).
+			SetHeader("Accept", "application/json").
+			SetHeader("X-Postmark-Server-Token", cfg.ServerToken),
+	}
+}
+
+func (s *PostmarkEmailSender) Send(_ micro.Ctx, message micro.Email) error {
+	from, err := mailerFrom(message, s.cfg.From)
+	if err != nil {
+		return err
+	}
+	attachments, err := message.LoadAttachments()
+	if err != nil {
+		return err
+	}
+	body := h.Map{
+		"From": mimeAddress(*from),
+		"To":   strings.Join(addressList(message.To), ","),
+	}
+	if len(message.Cc) > 0 {
+		body["Cc"] = strings.Join(addressList(message.Cc), ",")
+	}
+	if len(message.Bcc) > 0 {
+		body["Bcc"] = strings.Join(addressList(message.Bcc), ",")
+	}
+	if message.ReplyTo != nil {
+		body["ReplyTo"] = mimeAddress(*message.ReplyTo)
+	}
+	if s.cfg.MessageStream != "" {
+		body["MessageStream"] = s.cfg.MessageStream
+	}
+	if len(message.Categories) > 0 {
+		// postmark supports a single tag per email
+		body["Tag"] = message.Categories[0]
+	}
+	headers := make([]postmarkHeader, 0, len(message.Headers))
+	for k, v := range message.Headers {
+		headers = append(headers, postmarkHeader{Name: k, Value: v})
+	}
+	body["Headers"] = headers
+	files := make([]postmarkAttachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		file := postmarkAttachment{
+			Name:        attachment.Filename,
+			Content:     base64.StdEncoding.EncodeToString(attachment.Content),
+			ContentType: attachment.ContentType,
+		}
+		if attachment.Inline {
+			file.ContentID = "cid:" + attachment.ContentId
+		}
+		files = append(files, file)
+	}
+	body["Attachments"] = files
+
+	endpoint := "/email"
+	if message.TemplateId != "" {
+		endpoint = "/email/withTemplate"
+		if id, err := strconv.Atoi(message.TemplateId); err == nil {
+			body["TemplateId"] = id
+		} else {
+			body["TemplateAlias"] = message.TemplateId
+		}
+		body["TemplateModel"] = message.TemplateData
+	} else {
+		body["Subject"] = message.Subject
+		if html := message.Html(); html != "" {
+			body["HtmlBody"] = html
+		}
+		if message.TextBody != "" {
+			body["TextBody"] = message.TextBody
+		}
+	}
+
+	var failure postmarkErrorResponse
+	res, err := s.client.R().SetBody(body).SetError(&failure).Post(s.cfg.BaseUrl + endpoint)
+	if err != nil {
+		return err
+	}
+	if res.IsError() {
+		if failure.Message == "" {
+			failure.Message = strings.TrimSpace(res.String())
+		}
+		return &micro.MailerError{
+			Provider:   "postmark",
+			StatusCode: res.StatusCode(),
+			Code:       strconv.Itoa(failure.ErrorCode),
+			Message:    failure.Message,
+		}
+	}
+	log.Infof("Email sent to %v", message.Recipients())
+	return nil
+}
+
+func (s *PostmarkEmailSender) SendBatch(ctx micro.Ctx, messages []micro.Email) error {
+	return sendEach(ctx, s, messages)
+}
@@ -0,0 +1,284 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/qoalis/go-micro/micro"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	errUpstreamUnavailable = errors.New("upstream_unavailable")
+	errUpstreamTimeout     = errors.New("upstream_timeout")
+)
+
+// =================================================================================
+// REVERSE PROXY
+// =================================================================================
+
+// proxyRoute is the upstream of a proxied request, it is carried by the request context from the
+// handler to the transport
+type proxyRoute struct {
+	upstream *micro.Upstream
+	path     string
+	err      error
+}
+
+type proxyRouteKey struct{}
+
+// NewProxyTransport is the default transport of the proxies, it keeps more idle connections per
+// upstream than the default one
+func NewProxyTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 512
+	transport.MaxIdleConnsPerHost = 64
+	transport.IdleConnTimeout = 90 * time.Second
+	return transport
+}
+
+func newReverseProxy(transport http.RoundTripper, trusted []*net.IPNet) *httputil.ReverseProxy {
+	if transport == nil {
+		transport = NewProxyTransport()
+	}
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			route := r.In.Context().Value(proxyRouteKey{}).(*proxyRoute)
+			// the chain is only kept when it is sent by a trusted load balancer
+			if isTrustedProxy(trusted, r.In.RemoteAddr) {
+				r.Out.Header["X-Forwarded-For"] = r.In.Header["X-Forwarded-For"]
+			}
+			r.SetXForwarded()
+			// the address is picked by the transport for every attempt
+			r.Out.URL.Path = route.path
+			r.Out.URL.RawPath = ""
+			r.Out.Host = ""
+		},
+		Transport: &upstreamTransport{base: transport},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			r.Context().Value(proxyRouteKey{}).(*proxyRoute).err = err
+		},
+	}
+}
+
+// parseTrustedProxies parses the IPs and CIDRs of the trusted load balancers
+func parseTrustedProxies(values []string) []*net.IPNet {
+	var trusted []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			log.Fatalf("invalid trusted proxy %s -- %v", value, err)
+		}
+		trusted = append(trusted, network)
+	}
+	return trusted
+}
+
+func isTrustedProxy(trusted []*net.IPNet, remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveProxy forwards the request to the upstream, the errors are returned to echo
+func serveProxy(c echo.Context, proxy *httputil.ReverseProxy, upstream *micro.Upstream, path string) error {
+	route := &proxyRoute{upstream: upstream, path: path}
+	req := c.Request()
+	if authz, ok := c.Get(micro.AuthKey).(*micro.Authentication); ok && authz.Authenticated && authz.Authorization != "" {
+		log.Info("[proxy] authentication found in current context, passing down")
+		req.Header.Set("Authorization", authz.Authorization)
+	}
+	proxy.ServeHTTP(c.Response(), req.WithContext(context.WithValue(req.Context(), proxyRouteKey{}, route)))
+	switch {
+	case route.err == nil:
+		return nil
+	case errors.Is(route.err, errUpstreamUnavailable):
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "upstream_unavailable")
+	case errors.Is(route.err, errUpstreamTimeout):
+		return echo.NewHTTPError(http.StatusGatewayTimeout, "upstream_timeout")
+	case errors.Is(route.err, context.Canceled):
+		// the client is gone
+		return nil
+	default:
+		log.Warnf("[proxy] %s %s failed -- %v", req.Method, path, route.err)
+		return echo.NewHTTPError(http.StatusBadGateway, "upstream_error")
+	}
+}
+
+// RegisterUpstreamRoutes exposes the route table of the upstreams, with the state of their
+// instances, the filters must restrict them to the administrators
+func RegisterUpstreamRoutes(router micro.BaseRouter, upstreams *micro.RouterUpstream, filters ...micro.MiddlewareFunc) {
+	if len(filters) == 0 {
+		log.Fatalf("upstream routes require filters restricting them to the administrators")
+	}
+	router.GET("", func(ctx micro.Ctx) (any, error) {
+		return upstreams.Routes(), nil
+	}, filters...)
+}
+
+// upstreamTransport picks an address of the upstream for every attempt, applies the timeout and
+// the retries and reports the outcome to the circuit breakers
+type upstreamTransport struct {
+	base http.RoundTripper
+}
+
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	route := req.Context().Value(proxyRouteKey{}).(*proxyRoute)
+	up := route.upstream
+	attempts := 1
+	if replayable(req) && up.Retries > 0 {
+		attempts += up.Retries
+	}
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		uri, release, ok := up.Acquire()
+		if !ok {
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, errUpstreamUnavailable
+		}
+		resp, err := t.attempt(req, up, uri)
+		if err != nil && req.Context().Err() != nil {
+			// the client is gone, which tells nothing about the instance
+			release(micro.RequestAbandoned)
+			return nil, err
+		}
+		failed := err != nil || isUnavailable(resp.StatusCode)
+		if failed && attempt < attempts-1 {
+			release(micro.RequestFailed)
+			if err == nil {
+				_ = resp.Body.Close()
+				err = fmt.Errorf("upstream responded %d", resp.StatusCode)
+			}
+			lastErr = err
+			log.Warnf("[proxy] %s %s failed on %s, retrying -- %v", req.Method, req.URL.Path, uri, err)
+			continue
+		}
+		if err != nil {
+			release(micro.RequestFailed)
+			return nil, err
+		}
+		outcome := micro.RequestSucceeded
+		if failed {
+			outcome = micro.RequestFailed
+		}
+		// the instance is busy until the body is consumed, which includes streams and upgrades
+		resp.Body = releasingBody(resp.Body, func() { release(outcome) })
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+func (t *upstreamTransport) attempt(req *http.Request, up *micro.Upstream, uri string) (*http.Response, error) {
+	target, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	timeout := up.Timeout
+	if timeout <= 0 {
+		timeout = micro.DefaultProxyTimeout
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	out := req.Clone(ctx)
+	out.URL.Scheme = target.Scheme
+	out.URL.Host = target.Host
+	out.URL.Path = target.JoinPath(req.URL.Path).Path
+	if !strings.HasPrefix(out.URL.Path, "/") {
+		out.URL.Path = "/" + out.URL.Path
+	}
+	// the timeout only covers the response headers so that streams are not cut
+	timer := time.AfterFunc(timeout, cancel)
+	resp, err := t.base.RoundTrip(out)
+	if !timer.Stop() {
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		cancel()
+		return nil, fmt.Errorf("%w after %s", errUpstreamTimeout, timeout)
+	}
+	if err != nil {
+		cancel()
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, fmt.Errorf("%w -- %v", errUpstreamTimeout, err)
+		}
+		return nil, err
+	}
+	resp.Body = releasingBody(resp.Body, cancel)
+	return resp, nil
+}
+
+// replayable requests are idempotent and have no body
+func replayable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return req.Body == nil || req.Body == http.NoBody
+	}
+	return false
+}
+
+func isUnavailable(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// releasingBody calls release once the body is closed, the body of a protocol upgrade stays
+// writable for the reverse proxy
+func releasingBody(body io.ReadCloser, release func()) io.ReadCloser {
+	if rwc, ok := body.(io.ReadWriteCloser); ok {
+		return &releasingReadWriteCloser{ReadWriteCloser: rwc, release: release}
+	}
+	return &releasingReadCloser{ReadCloser: body, release: release}
+}
+
+type releasingReadCloser struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingReadCloser) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+type releasingReadWriteCloser struct {
+	io.ReadWriteCloser
+	release func()
+}
+
+func (b *releasingReadWriteCloser) Close() error {
+	err := b.ReadWriteCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,293 @@
+package adapters_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/qoalis/go-micro/adapters"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/middleware"
+	"github.com/qoalis/go-micro/tests"
+	"github.com/qoalis/go-micro/util/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newProxyGateway(t *testing.T, upstreams map[string]*micro.Upstream) (*httptest.Server, *micro.RouterUpstream) {
+	app := adapters.NewApp("gateway", "1.0", micro.Cfg{})
+	app.Init(nil)
+	router := micro.NewRouterUpstream(upstreams)
+	app.Router.Proxy("/api/*", router)
+	gateway := httptest.NewServer(app.Router.Handler())
+	t.Cleanup(gateway.Close)
+	return gateway, router
+}
+
+func TestProxyForwarding(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s?%s for=%s proto=%s host=%s", r.Method, r.URL.Path, r.URL.RawQuery,
+			r.Header.Get("X-Forwarded-For"), r.Header.Get("X-Forwarded-Proto"), r.Header.Get("X-Forwarded-Host"))
+	}))
+	defer backend.Close()
+	gateway, _ := newProxyGateway(t, map[string]*micro.Upstream{
+		"orders": {Prefix: "/api/orders", Uri: backend.URL, Strip: true},
+		"users":  {Prefix: "/api/users", Uri: backend.URL + "/v1"},
+	})
+	host := strings.TrimPrefix(gateway.URL, "http://")
+
+	resp, err := http.Get(gateway.URL + "/api/orders/42?expand=lines&page=2")
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "GET /42?expand=lines&page=2 for=127.0.0.1 proto=http host="+host, string(body))
+
+	// the chain sent by the clients is replaced, it is only kept behind the trusted proxies
+	forwarded := func(gateway *httptest.Server) string {
+		req, _ := http.NewRequest(http.MethodGet, gateway.URL+"/api/orders", nil)
+		req.Header.Set("X-Forwarded-For", "10.0.0.1")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	assert.Contains(t, forwarded(gateway), "GET /? for=127.0.0.1 ")
+	t.Setenv("TRUSTED_PROXIES", "10.1.0.0/16, 127.0.0.1")
+	trusted, _ := newProxyGateway(t, map[string]*micro.Upstream{
+		"orders": {Prefix: "/api/orders", Uri: backend.URL, Strip: true},
+	})
+	assert.Contains(t, forwarded(trusted), "GET /? for=10.0.0.1, 127.0.0.1 ")
+
+	resp, err = http.Post(gateway.URL+"/api/users", "text/plain", strings.NewReader("john"))
+	assert.Nil(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	assert.True(t, strings.HasPrefix(string(body), "POST /v1/api/users?"))
+
+	resp, _ = http.Get(gateway.URL + "/api/unknown")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestProxyRetriesAndCircuitBreaker(t *testing.T) {
+	var failures atomic.Int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failures.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer healthy.Close()
+	gateway, router := newProxyGateway(t, map[string]*micro.Upstream{
+		"billing": {Prefix: "/api/billing", Uri: failing.URL, Retries: 1},
+		"orders":  {Prefix: "/api/orders", Retries: 1, BreakerThreshold: 2, BreakerCooldown: time.Minute},
+	})
+	router.SetInstances("orders", []micro.ServiceInstance{{Id: "a", Url: failing.URL}, {Id: "b", Url: healthy.URL}})
+
+	// requests with a body are not retried, idempotent ones are
+	resp, err := http.Post(gateway.URL+"/api/billing", "text/plain", strings.NewReader("invoice"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), failures.Load())
+	resp, err = http.Get(gateway.URL + "/api/billing")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(3), failures.Load())
+
+	// the retries go to the other instance
+	for i := 0; i < 2; i++ {
+		resp, err = http.Get(gateway.URL + "/api/orders")
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.Equal(t, int32(5), failures.Load())
+
+	// the failing instance is skipped once its circuit is open
+	for i := 0; i < 4; i++ {
+		resp, err = http.Post(gateway.URL+"/api/orders", "text/plain", strings.NewReader("order"))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.Equal(t, int32(5), failures.Load())
+
+	healthy.Close()
+	resp, err = http.Get(gateway.URL + "/api/orders")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	for i := 0; i < 2; i++ {
+		resp, _ = http.Get(gateway.URL + "/api/orders")
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestProxyTimeout(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	gateway, _ := newProxyGateway(t, map[string]*micro.Upstream{
+		"orders": {Prefix: "/api/orders", Uri: slow.URL, Timeout: 50 * time.Millisecond},
+	})
+	resp, err := http.Get(gateway.URL + "/api/orders")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+}
+
+func TestProxyClientCancellation(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer slow.Close()
+	defer close(release)
+	gateway, _ := newProxyGateway(t, map[string]*micro.Upstream{
+		"orders": {Prefix: "/api/orders", Uri: slow.URL, Retries: 2, BreakerThreshold: 1, BreakerCooldown: time.Minute},
+	})
+
+	// the cancelled request is neither retried nor counted as a failure of the instance
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, gateway.URL+"/api/orders", nil)
+	_, err := http.DefaultClient.Do(req)
+	assert.NotNil(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), calls.Load())
+
+	resp, err := http.Get(gateway.URL + "/api/orders")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestProxyStreaming(t *testing.T) {
+	next := make(chan struct{})
+	events := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 1; i <= 2; i++ {
+			_, _ = fmt.Fprintf(w, "data: event %d\n\n", i)
+			w.(http.Flusher).Flush()
+			<-next
+		}
+	}))
+	defer events.Close()
+	// the stream outlives the timeout of the response headers
+	gateway, _ := newProxyGateway(t, map[string]*micro.Upstream{
+		"events": {Prefix: "/api/events", Uri: events.URL, Timeout: 50 * time.Millisecond},
+	})
+
+	resp, err := http.Get(gateway.URL + "/api/events")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	for i := 1; i <= 2; i++ {
+		line, err := reader.ReadString('\n')
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("data: event %d\n", i), line)
+		_, _ = reader.ReadString('\n')
+		time.Sleep(60 * time.Millisecond)
+		next <- struct{}{}
+	}
+}
+
+func TestProxyWebSocket(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		_ = rw.Flush()
+		line, _ := rw.ReadString('\n')
+		_, _ = rw.WriteString("echo " + line)
+		_ = rw.Flush()
+	}))
+	defer backend.Close()
+	gateway, _ := newProxyGateway(t, map[string]*micro.Upstream{
+		"ws": {Prefix: "/api/ws", Uri: backend.URL},
+	})
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(gateway.URL, "http://"))
+	assert.Nil(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, _ = io.WriteString(conn, "GET /api/ws HTTP/1.1\r\nHost: gateway\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	_, _ = io.WriteString(conn, "hello\n")
+	line, err := reader.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "echo hello\n", line)
+}
+
+func TestProxyRulesFiltersAndRouteTable(t *testing.T) {
+	backend := func(name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, "%s %s", name, r.URL.Path)
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	api, users, admin := backend("api"), backend("users"), backend("admin")
+	t.Setenv(micro.ServerToken, "secret")
+	t.Setenv(micro.DatabaseUrl, "file:"+filepath.Join(t.TempDir(), "gateway.db"))
+	app := adapters.NewApp("gateway", "1.0", micro.Cfg{})
+	app.Init(nil)
+	upstreams := micro.NewRouterUpstream(map[string]*micro.Upstream{
+		"api":   {Prefix: "/api", Uri: api.URL},
+		"users": {Prefix: "/api/users", Uri: users.URL, Rewrites: []micro.PathRewrite{{Pattern: `^/api/users`, Replacement: "/v2/accounts"}}},
+		"admin": {Prefix: "/api/users", Uri: admin.URL, Headers: map[string]string{"X-Admin": ""},
+			Filters: []micro.MiddlewareFunc{func(ctx micro.Ctx) error {
+				return errors.Forbidden("admins_only")
+			}}},
+	})
+	app.Router.Proxy("/api/*", upstreams)
+	adapters.RegisterUpstreamRoutes(app.Router.Group("/admin/upstreams"), upstreams, middleware.Admin())
+	gateway := httptest.NewServer(app.Router.Handler())
+	defer gateway.Close()
+	get := func(path string) string {
+		resp, err := http.Get(gateway.URL + path)
+		assert.Nil(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	assert.Equal(t, "api /api/orders", get("/api/orders"))
+	assert.Equal(t, "users /v2/accounts/1", get("/api/users/1"))
+
+	f := tests.HttpTestApp(t, app, nil)
+	f.GET("/api/users/1").Header("X-Admin", "1").Expect().IsForbidden()
+	f.GET("/admin/upstreams").Expect().IsUnauthorized()
+	f.AsUser("user_1", nil, nil, "").GET("/admin/upstreams").Expect().IsForbidden()
+	routes := f.AsUser("admin_1", []string{"admin"}, nil, "").GET("/admin/upstreams").Expect().IsOK().JSON()
+	routes.Array().Length().IsEqual(3)
+	routes.Path("$[0].id").String().IsEqual("admin")
+	routes.Path("$[0].filters").Number().IsEqual(1)
+	routes.Path("$[1].rewrites[0].replacement").String().IsEqual("/v2/accounts")
+	routes.Path("$[2].id").String().IsEqual("api")
+	routes.Path("$[2].instances").Array().IsEmpty()
+}
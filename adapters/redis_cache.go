@@ -0,0 +1,241 @@
+package adapters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/h"
+	"github.com/qoalis/go-micro/util/ids"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+const CacheInvalidationChannel = "cache_invalidations"
+
+// =================================================================================
+// REDIS CACHE
+// =================================================================================
+
+type RedisCache struct {
+	micro.Cache
+	client    *redis.Client
+	namespace string
+	ttl       time.Duration
+}
+
+func NewRedisCache(client *redis.Client, namespace string, ttl time.Duration) *RedisCache {
+	if ttl <= 0 {
+		ttl = micro.DefaultCacheTTL
+	}
+	if namespace == "" {
+		namespace = "cache"
+	}
+	return &RedisCache{client: client, namespace: namespace, ttl: ttl}
+}
+
+func (c *RedisCache) key(ctx micro.Ctx, key string) string {
+	return c.namespace + ":" + micro.CacheKey(ctx, key)
+}
+
+func (c *RedisCache) Get(ctx micro.Ctx, key string, target any) (bool, error) {
+	value, err := c.client.Get(context.Background(), c.key(ctx, key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, h.DeserializeJsonBytes(value, target)
+}
+
+func (c *RedisCache) Set(ctx micro.Ctx, key string, value any, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = c.ttl
+	}
+	serialized, err := h.ToJsonBytes(value)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(context.Background(), c.key(ctx, key), serialized, ttl).Err()
+}
+
+func (c *RedisCache) Delete(ctx micro.Ctx, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	namespaced := make([]string, 0, len(keys))
+	for _, key := range keys {
+		namespaced = append(namespaced, c.key(ctx, key))
+	}
+	return c.client.Del(context.Background(), namespaced...).Err()
+}
+
+func (c *RedisCache) DeleteByPrefix(ctx micro.Ctx, prefix string) error {
+	bg := context.Background()
+	iter := c.client.Scan(bg, 0, escapeGlob(c.key(ctx, prefix))+"*", 500).Iterator()
+	batch := make([]string, 0, 500)
+	for iter.Next(bg) {
+		batch = append(batch, iter.Val())
+		if len(batch) == cap(batch) {
+			if err := c.client.Del(bg, batch...).Err(); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return c.client.Del(bg, batch...).Err()
+	}
+	return nil
+}
+
+// escapeGlob makes the special characters of a SCAN pattern match themselves
+func escapeGlob(value string) string {
+	return globReplacer.Replace(value)
+}
+
+var globReplacer = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// =================================================================================
+// TWO-TIER CACHE
+// =================================================================================
+
+type cacheInvalidation struct {
+	Origin   string   `json:"origin"`
+	TenantId string   `json:"tenant"`
+	Keys     []string `json:"keys,omitempty"`
+	Prefix   string   `json:"prefix,omitempty"`
+}
+
+// TieredCache reads from a short-lived local tier backed by redis. Writes and deletes are broadcast
+// through redis pub/sub so that the local tier of every replica is invalidated.
+type TieredCache struct {
+	micro.Cache
+	local    *micro.LocalCache
+	remote   *RedisCache
+	localTTL time.Duration
+	origin   string
+	cancel   context.CancelFunc
+}
+
+func NewTieredCache(client *redis.Client, namespace string, ttl time.Duration, localTTL time.Duration) *TieredCache {
+	if localTTL <= 0 {
+		localTTL = time.Minute
+	}
+	remote := NewRedisCache(client, namespace, ttl)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &TieredCache{
+		local:    micro.NewCache(localTTL),
+		remote:   remote,
+		localTTL: localTTL,
+		origin:   ids.NewId(""),
+		cancel:   cancel,
+	}
+	// the subscription is confirmed before the cache is used, not to miss the first invalidations
+	sub := client.Subscribe(ctx, remote.namespace+":"+CacheInvalidationChannel)
+	if _, err := sub.Receive(ctx); err != nil {
+		log.Warnf("unable to subscribe to the cache invalidations: %s", err)
+	}
+	go c.listen(ctx, sub)
+	return c
+}
+
+func (c *TieredCache) Get(ctx micro.Ctx, key string, target any) (bool, error) {
+	if found, err := c.local.Get(ctx, key, target); err == nil && found {
+		return true, nil
+	}
+	found, err := c.remote.Get(ctx, key, target)
+	if err != nil || !found {
+		return found, err
+	}
+	_ = c.local.Set(ctx, key, target, c.ttlFor(ctx, key))
+	return true, nil
+}
+
+// ttlFor keeps local entries from outliving their remote counterpart
+func (c *TieredCache) ttlFor(ctx micro.Ctx, key string) time.Duration {
+	remaining, err := c.remote.client.PTTL(context.Background(), c.remote.key(ctx, key)).Result()
+	if err != nil || remaining <= 0 || remaining > c.localTTL {
+		return c.localTTL
+	}
+	return remaining
+}
+
+func (c *TieredCache) Set(ctx micro.Ctx, key string, value any, ttl time.Duration) error {
+	if err := c.remote.Set(ctx, key, value, ttl); err != nil {
+		return err
+	}
+	localTTL := c.localTTL
+	if ttl > 0 && ttl < localTTL {
+		localTTL = ttl
+	}
+	_ = c.local.Set(ctx, key, value, localTTL)
+	c.broadcast(cacheInvalidation{TenantId: ctx.TenantId, Keys: []string{key}})
+	return nil
+}
+
+func (c *TieredCache) Delete(ctx micro.Ctx, keys ...string) error {
+	_ = c.local.Delete(ctx, keys...)
+	if err := c.remote.Delete(ctx, keys...); err != nil {
+		return err
+	}
+	c.broadcast(cacheInvalidation{TenantId: ctx.TenantId, Keys: keys})
+	return nil
+}
+
+func (c *TieredCache) DeleteByPrefix(ctx micro.Ctx, prefix string) error {
+	_ = c.local.DeleteByPrefix(ctx, prefix)
+	if err := c.remote.DeleteByPrefix(ctx, prefix); err != nil {
+		return err
+	}
+	c.broadcast(cacheInvalidation{TenantId: ctx.TenantId, Prefix: prefix})
+	return nil
+}
+
+func (c *TieredCache) Close() {
+	c.cancel()
+}
+
+func (c *TieredCache) broadcast(message cacheInvalidation) {
+	message.Origin = c.origin
+	payload, err := h.ToJsonString(message)
+	if err != nil {
+		return
+	}
+	channel := c.remote.namespace + ":" + CacheInvalidationChannel
+	if err = c.remote.client.Publish(context.Background(), channel, payload).Err(); err != nil {
+		log.Warnf("unable to broadcast cache invalidation: %s", err)
+	}
+}
+
+func (c *TieredCache) listen(ctx context.Context, sub *redis.PubSub) {
+	//goland:noinspection ALL
+	defer sub.Close()
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var message cacheInvalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &message); err != nil || message.Origin == c.origin {
+				continue
+			}
+			tenantCtx := micro.NewCtx(nil, message.TenantId)
+			if message.Prefix != "" {
+				_ = c.local.DeleteByPrefix(tenantCtx, message.Prefix)
+			} else {
+				_ = c.local.Delete(tenantCtx, message.Keys...)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package adapters_test
+
+import (
+	"github.com/qoalis/go-micro/adapters"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRedisCache(t *testing.T) {
+	server, client := newMiniRedis(t)
+	cache := adapters.NewRedisCache(client, "", time.Minute)
+	acme, other := micro.NewCtx(nil, "acme"), micro.NewCtx(nil, "other")
+
+	assert.Nil(t, cache.Set(acme, "order:1", map[string]any{"total": 10}, 0))
+	var order map[string]any
+	found, err := cache.Get(acme, "order:1", &order)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, float64(10), order["total"])
+	assert.Equal(t, time.Minute, server.TTL("cache:acme:order:1"))
+
+	// the keys are scoped to the tenant
+	found, err = cache.Get(other, "order:1", &order)
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	assert.Nil(t, cache.Delete(acme, "order:1"))
+	found, _ = cache.Get(acme, "order:1", &order)
+	assert.False(t, found)
+
+	// the prefix is matched literally, its glob characters included
+	for _, key := range []string{"report[1]:a", "report1:a", "report?:a", "reportx:a", `report\:a`} {
+		assert.Nil(t, cache.Set(acme, key, 1, 0))
+	}
+	assert.Nil(t, cache.Set(other, "report[1]:a", 1, 0))
+	assert.Nil(t, cache.DeleteByPrefix(acme, "report[1]"))
+	assert.Nil(t, cache.DeleteByPrefix(acme, "report?"))
+	assert.Nil(t, cache.DeleteByPrefix(acme, `report\`))
+	var value int
+	for key, expected := range map[string]bool{"report[1]:a": false, "report1:a": true, "report?:a": false, "reportx:a": true, `report\:a`: false} {
+		found, err = cache.Get(acme, key, &value)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, found, key)
+	}
+	found, _ = cache.Get(other, "report[1]:a", &value)
+	assert.True(t, found)
+}
+
+func TestTieredCache(t *testing.T) {
+	server, client := newMiniRedis(t)
+	first := adapters.NewTieredCache(client, "", time.Minute, time.Minute)
+	defer first.Close()
+	second := adapters.NewTieredCache(client, "", time.Minute, time.Minute)
+	defer second.Close()
+	ctx := micro.NewCtx(nil, "acme")
+	read := func(cache *adapters.TieredCache, key string) (int, bool) {
+		var value int
+		found, err := cache.Get(ctx, key, &value)
+		assert.Nil(t, err)
+		return value, found
+	}
+
+	assert.Nil(t, first.Set(ctx, "count", 1, 0))
+	value, found := read(second, "count")
+	assert.True(t, found)
+	assert.Equal(t, 1, value)
+
+	// the local tier is read while it is valid
+	server.Set("cache:acme:count", "5")
+	value, _ = read(second, "count")
+	assert.Equal(t, 1, value)
+
+	// the writes of a replica invalidate the local tier of the others
+	assert.Nil(t, first.Set(ctx, "count", 2, 0))
+	assert.Eventually(t, func() bool {
+		value, _ := read(second, "count")
+		return value == 2
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, first.Delete(ctx, "count"))
+	assert.Eventually(t, func() bool {
+		_, found := read(second, "count")
+		return !found
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, second.Set(ctx, "orders:1", 1, 0))
+	value, found = read(first, "orders:1")
+	assert.True(t, found)
+	assert.Nil(t, second.DeleteByPrefix(ctx, "orders:"))
+	assert.Eventually(t, func() bool {
+		_, found := read(first, "orders:1")
+		return !found
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,157 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/dates"
+	"github.com/qoalis/go-micro/util/h"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// =================================================================================
+// REDIS SERVICE REGISTRY
+// =================================================================================
+
+// RedisRegistry stores every instance in its own key expiring with the ttl, the ids of the instances
+// of a service are indexed in a set which is cleaned up on lookup. Registrations and deregistrations
+// are published on micro.DiscoveryInstancesChannel so that the watchers react immediately, expirations
+// are noticed by polling.
+type RedisRegistry struct {
+	client    *redis.Client
+	namespace string
+	// Interval is how often the watchers look for expired instances
+	Interval time.Duration
+}
+
+func NewRedisRegistry(client *redis.Client, namespace string) *RedisRegistry {
+	if namespace == "" {
+		namespace = "registry"
+	}
+	return &RedisRegistry{client: client, namespace: namespace, Interval: micro.DefaultWatchInterval}
+}
+
+func (r *RedisRegistry) index(service string) string {
+	return r.namespace + ":" + service
+}
+
+func (r *RedisRegistry) key(service string, id string) string {
+	return r.namespace + ":" + service + ":" + id
+}
+
+func (r *RedisRegistry) Register(ctx context.Context, instance micro.ServiceInstance, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = micro.DefaultServiceTTL
+	}
+	key := r.key(instance.Service, instance.Id)
+	now := dates.Now()
+	instance.RegisteredAt = now
+	instance.ExpiresAt = now.Add(ttl)
+	var existing micro.ServiceInstance
+	previous, err := r.client.Get(ctx, key).Bytes()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	live := err == nil && h.DeserializeJsonBytes(previous, &existing) == nil
+	if live {
+		instance.RegisteredAt = existing.RegisteredAt
+	}
+	value, err := h.ToJsonBytes(instance)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, r.index(instance.Service), instance.Id)
+		pipe.Set(ctx, key, value, ttl)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !live || existing.Url != instance.Url || existing.Version != instance.Version {
+		return r.client.Publish(ctx, micro.DiscoveryInstancesChannel, instance.Service).Err()
+	}
+	return nil
+}
+
+func (r *RedisRegistry) Deregister(ctx context.Context, service string, id string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SRem(ctx, r.index(service), id)
+		pipe.Del(ctx, r.key(service, id))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, micro.DiscoveryInstancesChannel, service).Err()
+}
+
+func (r *RedisRegistry) Lookup(ctx context.Context, service string) ([]micro.ServiceInstance, error) {
+	ids, err := r.client.SMembers(ctx, r.index(service)).Result()
+	if err != nil || len(ids) == 0 {
+		return []micro.ServiceInstance{}, err
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = r.key(service, id)
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]micro.ServiceInstance, 0, len(values))
+	var expired []any
+	for i, value := range values {
+		raw, ok := value.(string)
+		if !ok {
+			expired = append(expired, ids[i])
+			continue
+		}
+		var instance micro.ServiceInstance
+		if err := h.DeserializeJsonBytes([]byte(raw), &instance); err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+	if len(expired) > 0 {
+		if err := r.client.SRem(ctx, r.index(service), expired...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	micro.SortInstances(instances)
+	return instances, nil
+}
+
+func (r *RedisRegistry) Watch(ctx context.Context, service string) (<-chan []micro.ServiceInstance, error) {
+	sub := r.client.Subscribe(ctx, micro.DiscoveryInstancesChannel)
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return nil, err
+	}
+	changed := make(chan struct{}, 1)
+	go func() {
+		defer func() { _ = sub.Close() }()
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				if msg.Payload != service {
+					continue
+				}
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return micro.WatchRegistry(ctx, func(ctx context.Context) ([]micro.ServiceInstance, error) {
+		return r.Lookup(ctx, service)
+	}, changed, r.Interval), nil
+}
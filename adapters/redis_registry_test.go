@@ -0,0 +1,116 @@
+package adapters_test
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/qoalis/go-micro/adapters"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newMiniRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return server, client
+}
+
+func instanceIds(instances []micro.ServiceInstance) []string {
+	result := make([]string, len(instances))
+	for i, instance := range instances {
+		result[i] = instance.Id
+	}
+	return result
+}
+
+func TestRedisRegistry(t *testing.T) {
+	server, client := newMiniRedis(t)
+	registry := adapters.NewRedisRegistry(client, "")
+	ctx := context.Background()
+
+	assert.Nil(t, registry.Register(ctx, micro.ServiceInstance{Id: "b", Service: "orders", Url: "http://b"}, 10*time.Second))
+	assert.Nil(t, registry.Register(ctx, micro.ServiceInstance{Id: "a", Service: "orders", Url: "http://a", Version: "2.0.0"}, 10*time.Second))
+	instances, err := registry.Lookup(ctx, "orders")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, instanceIds(instances))
+	assert.Equal(t, "2.0.0", instances[0].Version)
+	empty, err := registry.Lookup(ctx, "payments")
+	assert.Nil(t, err)
+	assert.Empty(t, empty)
+
+	// the instances without heartbeat expire and are removed from the index on lookup
+	server.FastForward(6 * time.Second)
+	assert.Nil(t, registry.Register(ctx, micro.ServiceInstance{Id: "b", Service: "orders", Url: "http://b"}, 10*time.Second))
+	server.FastForward(6 * time.Second)
+	members, _ := server.SMembers("registry:orders")
+	assert.Equal(t, []string{"a", "b"}, members)
+	instances, err = registry.Lookup(ctx, "orders")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b"}, instanceIds(instances))
+	members, _ = server.SMembers("registry:orders")
+	assert.Equal(t, []string{"b"}, members)
+
+	assert.Nil(t, registry.Deregister(ctx, "orders", "b"))
+	instances, _ = registry.Lookup(ctx, "orders")
+	assert.Empty(t, instances)
+	assert.False(t, server.Exists("registry:orders:b"))
+}
+
+func TestRedisRegistryWatch(t *testing.T) {
+	_, client := newMiniRedis(t)
+	registry := adapters.NewRedisRegistry(client, "")
+	// the changes are only noticed through pub/sub
+	registry.Interval = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.Nil(t, registry.Register(ctx, micro.ServiceInstance{Id: "a", Service: "orders", Url: "http://a"}, time.Minute))
+
+	updates, err := registry.Watch(ctx, "orders")
+	assert.Nil(t, err)
+	next := func() []string {
+		select {
+		case instances := <-updates:
+			return instanceIds(instances)
+		case <-time.After(time.Second):
+			t.Fatal("no update")
+			return nil
+		}
+	}
+	assert.Equal(t, []string{"a"}, next())
+
+	// the other services and the heartbeats do not notify the watchers
+	assert.Nil(t, registry.Register(ctx, micro.ServiceInstance{Id: "p", Service: "payments", Url: "http://p"}, time.Minute))
+	assert.Nil(t, registry.Register(ctx, micro.ServiceInstance{Id: "a", Service: "orders", Url: "http://a"}, time.Minute))
+	assert.Nil(t, registry.Register(ctx, micro.ServiceInstance{Id: "b", Service: "orders", Url: "http://b"}, time.Minute))
+	assert.Equal(t, []string{"a", "b"}, next())
+	assert.Nil(t, registry.Deregister(ctx, "orders", "a"))
+	assert.Equal(t, []string{"b"}, next())
+
+	cancel()
+	select {
+	case _, ok := <-updates:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("watch not closed")
+	}
+}
+
+func TestRedisRegistryKeepsLegacyChannel(t *testing.T) {
+	_, client := newMiniRedis(t)
+	registry := adapters.NewRedisRegistry(client, "")
+	ctx := context.Background()
+	legacy := client.Subscribe(ctx, micro.DiscoveryServicesChannel)
+	defer func() { _ = legacy.Close() }()
+	_, err := legacy.Receive(ctx)
+	assert.Nil(t, err)
+
+	// the registry notifications do not reach the consumers of the "name:url" messages
+	assert.Nil(t, registry.Register(ctx, micro.ServiceInstance{Id: "a", Service: "orders", Url: "http://a"}, time.Minute))
+	assert.Nil(t, client.Publish(ctx, micro.DiscoveryServicesChannel, "orders:a:8080").Err())
+	msg, err := legacy.ReceiveMessage(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "orders:a:8080", msg.Payload)
+}
@@ -1,17 +1,20 @@
 package adapters
 
 import (
+	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"github.com/qoalis/go-micro/micro"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 	log "github.com/sirupsen/logrus"
 )
 
+const SendGridDefaultBaseUrl = "https://api.sendgrid.com"
+
 type SendGridEmailSender struct {
 	micro.Mailer
-	apiKey string
+	apiKey  string
+	baseUrl string
 }
 
 type sengridError struct {
@@ -24,19 +27,62 @@ type sengridErrorResponse struct {
 	Errors []sengridError `json:"errors"`
 }
 
-func NewSendGridEmailSender(apikey string) micro.Mailer {
-	return SendGridEmailSender{apiKey: apikey}
+// NewSendGridEmailSender creates a sendgrid mailer, the base url defaults to SendGridDefaultBaseUrl
+func NewSendGridEmailSender(apikey string, baseUrl ...string) micro.Mailer {
+	s := SendGridEmailSender{apiKey: apikey, baseUrl: SendGridDefaultBaseUrl}
+	if len(baseUrl) > 0 && baseUrl[0] != "" {
+		s.baseUrl = baseUrl[0]
+	}
+	return s
 }
 
-func (s SendGridEmailSender) Send(message micro.Email) error {
+func (s SendGridEmailSender) Send(_ micro.Ctx, message micro.Email) error {
+	from, err := mailerFrom(message, nil)
+	if err != nil {
+		return err
+	}
 	m := mail.NewV3Mail()
-	m.SetFrom(mail.NewEmail(message.From.Name, message.From.Address))
+	m.SetFrom(mail.NewEmail(from.Name, from.Address))
 	m.Subject = message.Subject
 	p := mail.NewPersonalization()
-	recipients := make([]string, 0)
 	for _, to := range message.To {
 		p.AddTos(mail.NewEmail(to.Name, to.Address))
-		recipients = append(recipients, to.Address)
+	}
+	for _, cc := range message.Cc {
+		p.AddCCs(mail.NewEmail(cc.Name, cc.Address))
+	}
+	for _, bcc := range message.Bcc {
+		p.AddBCCs(mail.NewEmail(bcc.Name, bcc.Address))
+	}
+	recipients := message.Recipients()
+	if message.ReplyTo != nil {
+		m.SetReplyTo(mail.NewEmail(message.ReplyTo.Name, message.ReplyTo.Address))
+	}
+	// sendgrid requires the text content to come first
+	if message.TextBody != "" {
+		m.AddContent(mail.NewContent("text/plain", message.TextBody))
+	}
+	if html := message.Html(); html != "" {
+		m.AddContent(mail.NewContent("text/html", html))
+	}
+	for k, v := range message.Headers {
+		m.SetHeader(k, v)
+	}
+	m.AddCategories(message.Categories...)
+	attachments, err := message.LoadAttachments()
+	if err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		a := mail.NewAttachment().
+			SetContent(base64.StdEncoding.EncodeToString(attachment.Content)).
+			SetType(attachment.ContentType).
+			SetFilename(attachment.Filename).
+			SetDisposition("attachment")
+		if attachment.Inline {
+			a.SetDisposition("inline").SetContentID(attachment.ContentId)
+		}
+		m.AddAttachment(a)
 	}
 	if message.TemplateId != "" {
 		m.SetTemplateID(message.TemplateId)
@@ -46,7 +92,7 @@ func (s SendGridEmailSender) Send(message micro.Email) error {
 	}
 	m.AddPersonalizations(p)
 
-	request := sendgrid.GetRequest(s.apiKey, "/v3/mail/send", "https://api.sendgrid.com")
+	request := sendgrid.GetRequest(s.apiKey, "/v3/mail/send", s.baseUrl)
 	request.Method = "POST"
 	var Body = mail.GetRequestBody(m)
 	request.Body = Body
@@ -57,7 +103,12 @@ func (s SendGridEmailSender) Send(message micro.Email) error {
 	} else if res.StatusCode >= 300 {
 		var resultErr sengridErrorResponse
 		_ = json.Unmarshal([]byte(res.Body), &resultErr)
-		return fmt.Errorf("%s", resultErr.Errors[0].Message)
+		failure := &micro.MailerError{Provider: "sendgrid", StatusCode: res.StatusCode, Message: res.Body}
+		if len(resultErr.Errors) > 0 {
+			failure.Code = resultErr.Errors[0].Field
+			failure.Message = resultErr.Errors[0].Message
+		}
+		return failure
 	} else {
 		log.Infof("Email sent to %v", recipients)
 		/*model := ProjectInvitation{Id: invite.Id}
@@ -68,12 +119,6 @@ func (s SendGridEmailSender) Send(message micro.Email) error {
 	return nil
 }
 
-func (s SendGridEmailSender) SendBatch(message []micro.Email) error {
-	for _, msg := range message {
-		if err := s.Send(msg); err != nil {
-			log.Error(err)
-			return err
-		}
-	}
-	return nil
+func (s SendGridEmailSender) SendBatch(ctx micro.Ctx, messages []micro.Email) error {
+	return sendEach(ctx, s, messages)
 }
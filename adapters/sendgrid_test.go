@@ -11,7 +11,7 @@ import (
 
 func Test(t *testing.T) {
 	sender := NewSendGridEmailSender("foo")
-	err := sender.Send(micro.Email{
+	err := sender.Send(micro.NewCtx(nil, micro.DefaultTenantId), micro.Email{
 		From: &micro.EmailAddress{
 			Name:    gofakeit.Name(),
 			Address: gofakeit.Email(),
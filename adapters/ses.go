@@ -0,0 +1,229 @@
+package adapters
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/dates"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type SesConfig struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	// BaseUrl defaults to https://email.<region>.amazonaws.com, any SES v2 compatible api can be used
+	BaseUrl string
+	// ConfigurationSet is the optional SES configuration set used to track the emails
+	ConfigurationSet string
+	From             *micro.EmailAddress
+}
+
+// SesEmailSender sends emails with the SES v2 api (SendEmail), requests are signed with AWS SigV4.
+// Emails are sent as raw MIME messages so that every field of micro.Email is supported.
+type SesEmailSender struct {
+	micro.Mailer
+	cfg    SesConfig
+	client *http.Client
+}
+
+type sesErrorResponse struct {
+	Type    string `json:"__type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ParseSesUrl parses ses://<access_key_id>:<secret_access_key>@<region>?session_token=&configuration_set=&base_url=&from=
+func ParseSesUrl(value string) (SesConfig, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return SesConfig{}, err
+	}
+	cfg := SesConfig{
+		AccessKeyId:      u.User.Username(),
+		Region:           u.Host,
+		SessionToken:     u.Query().Get("session_token"),
+		ConfigurationSet: u.Query().Get("configuration_set"),
+		BaseUrl:          u.Query().Get("base_url"),
+	}
+	cfg.SecretAccessKey, _ = u.User.Password()
+	if cfg.From, err = parseMailerFrom(u.Query()); err != nil {
+		return cfg, err
+	}
+	if cfg.AccessKeyId == "" || cfg.SecretAccessKey == "" || cfg.Region == "" {
+		return cfg, errors.New("ses credentials or region are missing")
+	}
+	return cfg, nil
+}
+
+func NewSesEmailSender(cfg SesConfig) *SesEmailSender {
+	if cfg.BaseUrl == "" {
+		cfg.BaseUrl = fmt.Sprintf("https://email.%s.amazonaws.com", cfg.Region)
+	}
+	return &SesEmailSender{cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (s *SesEmailSender) Send(_ micro.Ctx, message micro.Email) error {
+	from, err := mailerFrom(message, s.cfg.From)
+	if err != nil {
+		return err
+	}
+	message.From = from
+	destination := map[string][]string{
+		"ToAddresses":  addressList(message.To),
+		"CcAddresses":  addressList(message.Cc),
+		"BccAddresses": addressList(message.Bcc),
+	}
+	body := map[string]any{
+		"FromEmailAddress": mimeAddress(*from),
+		"Destination":      destination,
+	}
+	if message.ReplyTo != nil {
+		body["ReplyToAddresses"] = []string{mimeAddress(*message.ReplyTo)}
+	}
+	if s.cfg.ConfigurationSet != "" {
+		body["ConfigurationSetName"] = s.cfg.ConfigurationSet
+	}
+	tags := make([]map[string]string, 0, len(message.Categories))
+	for _, category := range message.Categories {
+		tags = append(tags, map[string]string{"Name": "category", "Value": category})
+	}
+	if len(tags) > 0 {
+		body["EmailTags"] = tags
+	}
+	if message.TemplateId != "" {
+		data, _ := json.Marshal(message.TemplateData)
+		body["Content"] = map[string]any{
+			"Template": map[string]string{"TemplateName": message.TemplateId, "TemplateData": string(data)},
+		}
+	} else {
+		attachments, err := message.LoadAttachments()
+		if err != nil {
+			return err
+		}
+		data, err := buildMimeMessage(message, attachments)
+		if err != nil {
+			return err
+		}
+		body["Content"] = map[string]any{
+			"Raw": map[string][]byte{"Data": data},
+		}
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.cfg.BaseUrl+"/v2/email/outbound-emails", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	s.sign(req, payload, dates.Now())
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	//goland:noinspection ALL
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		raw, _ := io.ReadAll(res.Body)
+		var failure sesErrorResponse
+		_ = json.Unmarshal(raw, &failure)
+		code := res.Header.Get("X-Amzn-ErrorType")
+		if code == "" {
+			code = failure.Type
+		}
+		if code == "" {
+			code = failure.Code
+		}
+		code, _, _ = strings.Cut(code, ":")
+		if failure.Message == "" {
+			failure.Message = strings.TrimSpace(string(raw))
+		}
+		return &micro.MailerError{Provider: "ses", StatusCode: res.StatusCode, Code: code, Message: failure.Message}
+	}
+	log.Infof("Email sent to %v", message.Recipients())
+	return nil
+}
+
+func (s *SesEmailSender) SendBatch(ctx micro.Ctx, messages []micro.Email) error {
+	return sendEach(ctx, s, messages)
+}
+
+// sign adds the AWS Signature Version 4 headers to the request
+func (s *SesEmailSender) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.cfg.SessionToken)
+	}
+
+	signedHeaders := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	if s.cfg.SessionToken != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.cfg.Region + "/ses/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+	key := hmacSha256([]byte("AWS4"+s.cfg.SecretAccessKey), day)
+	key = hmacSha256(key, s.cfg.Region)
+	key = hmacSha256(key, "ses")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKeyId, scope, strings.Join(signedHeaders, ";"), signature,
+	))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
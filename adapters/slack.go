@@ -0,0 +1,84 @@
+package adapters
+
+import (
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/h"
+	"strings"
+)
+
+type slackClient struct {
+	micro.NotificationService
+	webHookUrl string
+	client     *resty.Client
+}
+
+// NewSlackClient sends notifications to a slack incoming webhook
+func NewSlackClient(webhook string) micro.NotificationService {
+	return &slackClient{
+		webHookUrl: webhook,
+		client:     resty.New(),
+	}
+}
+
+func (s *slackClient) Send(_ micro.Ctx, message micro.Notification) error {
+	out, err := s.client.R().
+		SetBody(slackPayload(message)).
+		Post(s.webHookUrl)
+	if err != nil {
+		return fmt.Errorf("failed to send slack message -- %v", redactUrl(err))
+	}
+	if out.IsError() {
+		return fmt.Errorf("failed to send slack message -- %s", out.Body())
+	}
+	return nil
+}
+
+// slackPayload renders the notification with blocks, the text is used as the fallback
+func slackPayload(message micro.Notification) h.Map {
+	blocks := make([]h.Map, 0)
+	if message.Title != "" {
+		blocks = append(blocks, h.Map{
+			"type": "header",
+			"text": h.Map{"type": "plain_text", "text": message.Title},
+		})
+	}
+	if message.Message != "" {
+		blocks = append(blocks, h.Map{
+			"type": "section",
+			"text": h.Map{"type": "mrkdwn", "text": message.Message},
+		})
+	}
+	if len(message.Fields) > 0 {
+		fields := make([]h.Map, 0, len(message.Fields))
+		for _, field := range message.Fields {
+			fields = append(fields, h.Map{"type": "mrkdwn", "text": fmt.Sprintf("*%s*\n%s", field.Name, field.Value)})
+		}
+		// slack accepts at most 10 fields per section
+		for len(fields) > 0 {
+			n := min(len(fields), 10)
+			blocks = append(blocks, h.Map{"type": "section", "fields": fields[:n]})
+			fields = fields[n:]
+		}
+	}
+	if len(message.Links) > 0 {
+		links := make([]string, 0, len(message.Links))
+		for _, link := range message.Links {
+			links = append(links, fmt.Sprintf("<%s|%s>", link.Url, link.Label))
+		}
+		blocks = append(blocks, h.Map{
+			"type": "section",
+			"text": h.Map{"type": "mrkdwn", "text": strings.Join(links, " · ")},
+		})
+	}
+	context := []h.Map{{"type": "mrkdwn", "text": "*" + strings.ToUpper(string(severityOf(message))) + "*"}}
+	if footer := notificationFooter(message); footer != "" {
+		context = append(context, h.Map{"type": "mrkdwn", "text": footer})
+	}
+	blocks = append(blocks, h.Map{"type": "context", "elements": context})
+	return h.Map{
+		"text":   notificationText(message),
+		"blocks": blocks,
+	}
+}
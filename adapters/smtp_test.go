@@ -0,0 +1,109 @@
+package adapters_test
+
+import (
+	"encoding/base64"
+	"github.com/qoalis/go-micro/adapters"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/tests"
+	"github.com/qoalis/go-micro/util/h"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSmtpTemplatedEmail(t *testing.T) {
+	server := tests.NewSmtpServer(t)
+	cfg, err := adapters.ParseSmtpUrl(server.Url() + "&from=Acme <noreply@acme.test>")
+	assert.Nil(t, err)
+
+	templates := adapters.NewEmailTemplates(fstest.MapFS{
+		"welcome.subject":    {Data: []byte("Welcome {{ .name }}")},
+		"welcome.html":       {Data: []byte("<p>Hello {{ .name }}</p>")},
+		"fr/welcome.subject": {Data: []byte("Bienvenue {{ .name }}")},
+		"fr/welcome.html":    {Data: []byte("<p>Bonjour {{ .name }}</p>")},
+	}, nil, "en")
+	mailer := adapters.NewTemplatedMailer(adapters.NewSmtpEmailSender(cfg), templates)
+
+	err = mailer.Send(micro.NewCtx(nil, micro.DefaultTenantId), micro.Email{
+		To:           []micro.EmailAddress{{Name: "Jane", Address: "jane@example.com"}},
+		TemplateId:   "welcome",
+		TemplateData: h.Map{"name": "Jane"},
+		Locale:       "fr",
+	})
+	assert.Nil(t, err)
+
+	messages := server.WaitFor(1)
+	assert.Equal(t, "noreply@acme.test", messages[0].From)
+	assert.Equal(t, []string{"jane@example.com"}, messages[0].To)
+	assert.Equal(t, "user", messages[0].Username)
+	assert.Contains(t, messages[0].Data, "Subject: Bienvenue Jane")
+	body, _ := io.ReadAll(quotedprintable.NewReader(strings.NewReader(messages[0].Data)))
+	assert.Contains(t, string(body), "<p>Bonjour Jane</p>")
+}
+
+func TestSmtpMultipartEmail(t *testing.T) {
+	server := tests.NewSmtpServer(t)
+	cfg, err := adapters.ParseSmtpUrl(server.Url() + "&from=noreply@acme.test")
+	assert.Nil(t, err)
+
+	// the values written in the headers cannot inject other headers
+	injections := []struct {
+		message micro.Email
+		err     string
+	}{
+		{micro.Email{Headers: map[string]string{"X-Invoice\r\nBcc": "spy@example.com"}}, "invalid email header"},
+		{micro.Email{Categories: []string{"billing\r\nBcc: spy@example.com"}}, "invalid email category"},
+		{micro.Email{Attachments: []micro.EmailAttachment{{Filename: "invoice.txt\nBcc: spy@example.com", Content: []byte("42")}}}, "invalid attachment filename"},
+		{micro.Email{Attachments: []micro.EmailAttachment{{Filename: "logo.png", ContentId: "logo\r\nBcc: spy@example.com", Inline: true, Content: []byte("42")}}}, "invalid attachment content id"},
+	}
+	for _, injection := range injections {
+		message := injection.message
+		message.To = []micro.EmailAddress{{Address: "jane@example.com"}}
+		message.Subject = "Invoice"
+		message.TextBody = "Your invoice"
+		err = adapters.NewSmtpEmailSender(cfg).Send(micro.NewCtx(nil, micro.DefaultTenantId), message)
+		assert.ErrorContains(t, err, injection.err)
+	}
+
+	err = adapters.NewSmtpEmailSender(cfg).Send(micro.NewCtx(nil, micro.DefaultTenantId), micro.Email{
+		To:       []micro.EmailAddress{{Address: "jane@example.com"}},
+		Cc:       []micro.EmailAddress{{Address: "john@example.com"}},
+		Bcc:      []micro.EmailAddress{{Address: "audit@acme.test"}},
+		ReplyTo:  &micro.EmailAddress{Address: "support@acme.test"},
+		Subject:  "Invoice",
+		HtmlBody: "<p>Your invoice</p>",
+		TextBody: "Your invoice",
+		Headers:  map[string]string{"X-Invoice": "42"},
+		Attachments: []micro.EmailAttachment{
+			{Filename: "invoice.txt", Content: []byte("total: 42")},
+		},
+	})
+	assert.Nil(t, err)
+
+	messages := server.WaitFor(1)
+	assert.Equal(t, []string{"jane@example.com", "john@example.com", "audit@acme.test"}, messages[0].To)
+	msg, err := mail.ReadMessage(strings.NewReader(messages[0].Data))
+	assert.Nil(t, err)
+	assert.Equal(t, "<john@example.com>", msg.Header.Get("Cc"))
+	assert.Empty(t, msg.Header.Get("Bcc"))
+	assert.Equal(t, "<support@acme.test>", msg.Header.Get("Reply-To"))
+	assert.Equal(t, "42", msg.Header.Get("X-Invoice"))
+
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.Equal(t, "multipart/mixed", mediaType)
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	body, err := reader.NextPart()
+	assert.Nil(t, err)
+	assert.Contains(t, body.Header.Get("Content-Type"), "multipart/alternative")
+	attachment, err := reader.NextPart()
+	assert.Nil(t, err)
+	assert.Equal(t, "invoice.txt", attachment.FileName())
+	content, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+	assert.Equal(t, "total: 42", string(content))
+}
@@ -0,0 +1,72 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/h"
+	"net/url"
+)
+
+const TelegramDefaultBaseUrl = "https://api.telegram.org"
+
+type telegramClient struct {
+	micro.NotificationService
+	token   string
+	chatId  string
+	baseUrl string
+	client  *resty.Client
+}
+
+// NewTelegramClient parses telegram://<bot_token>@<chat_id>?base_url= and sends the notifications
+// with the bot api
+func NewTelegramClient(value string) (micro.NotificationService, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	c := &telegramClient{
+		token:   u.User.String(),
+		chatId:  u.Host,
+		baseUrl: u.Query().Get("base_url"),
+		client:  resty.New(),
+	}
+	if c.token == "" || c.chatId == "" {
+		return nil, errors.New("telegram bot token or chat id is missing")
+	}
+	if c.baseUrl == "" {
+		c.baseUrl = TelegramDefaultBaseUrl
+	}
+	return c, nil
+}
+
+// Ping checks the bot token with the getMe method
+func (s *telegramClient) Ping(ctx context.Context) error {
+	// the url holds the bot token, it is left out of the errors
+	out, err := s.client.R().SetContext(ctx).Get(s.baseUrl + "/bot" + s.token + "/getMe")
+	if err != nil {
+		return errors.New("telegram bot is unreachable")
+	}
+	if out.IsError() {
+		return fmt.Errorf("telegram bot is unavailable -- %s", out.Status())
+	}
+	return nil
+}
+
+func (s *telegramClient) Send(_ micro.Ctx, message micro.Notification) error {
+	out, err := s.client.R().
+		SetBody(h.Map{
+			"chat_id": s.chatId,
+			"text":    notificationText(message),
+		}).
+		Post(s.baseUrl + "/bot" + s.token + "/sendMessage")
+	if err != nil {
+		return fmt.Errorf("failed to send telegram message -- %v", redactUrl(err))
+	}
+	if out.IsError() {
+		return fmt.Errorf("failed to send telegram message -- %s", out.Body())
+	}
+	return nil
+}
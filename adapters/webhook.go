@@ -0,0 +1,105 @@
+package adapters
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/h"
+	"net/url"
+	"strings"
+)
+
+type webhookClient struct {
+	micro.NotificationService
+	url    string
+	client *resty.Client
+}
+
+// NewWebhookClient posts notifications as JSON to any url:
+//
+//	{"app": "...", "tenant": "...", "severity": "...", "topic": "...", "title": "...", "message": "...",
+//	 "fields": [{"name": "...", "value": "..."}], "links": [{"label": "...", "url": "..."}]}
+func NewWebhookClient(url string) micro.NotificationService {
+	return &webhookClient{
+		url:    url,
+		client: resty.New(),
+	}
+}
+
+func (s *webhookClient) Send(ctx micro.Ctx, message micro.Notification) error {
+	tenant := message.TenantId
+	if tenant == "" {
+		tenant = ctx.TenantId
+	}
+	body := h.Map{
+		"tenant":   tenant,
+		"severity": severityOf(message),
+		"topic":    message.Topic,
+		"title":    message.Title,
+		"message":  message.Message,
+		"fields":   message.Fields,
+		"links":    message.Links,
+	}
+	if ctx.Env != nil {
+		body["app"] = ctx.Env.AppName
+	}
+	out, err := s.client.R().SetBody(body).Post(s.url)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook notification -- %v", redactUrl(err))
+	}
+	if out.IsError() {
+		return fmt.Errorf("failed to send webhook notification -- %d %s", out.StatusCode(), out.Body())
+	}
+	return nil
+}
+
+func severityOf(message micro.Notification) micro.Severity {
+	if message.Severity == "" {
+		return micro.SeverityInfo
+	}
+	return micro.Severity(strings.ToLower(string(message.Severity)))
+}
+
+// notificationText formats a notification as a plain text message for chat and email channels
+func notificationText(message micro.Notification) string {
+	var b strings.Builder
+	if severity := severityOf(message); severity != micro.SeverityInfo {
+		b.WriteString("[" + strings.ToUpper(string(severity)) + "] ")
+	}
+	if message.Topic != "" {
+		b.WriteString(message.Topic + ": ")
+	}
+	if message.Title != "" {
+		b.WriteString(message.Title + "\n")
+	}
+	b.WriteString(message.Message)
+	for _, field := range message.Fields {
+		b.WriteString("\n" + field.Name + ": " + field.Value)
+	}
+	for _, link := range message.Links {
+		b.WriteString("\n" + link.Label + ": " + link.Url)
+	}
+	return b.String()
+}
+
+// notificationFooter describes the topic and tenant of the notification
+func notificationFooter(message micro.Notification) string {
+	parts := make([]string, 0, 2)
+	if message.Topic != "" {
+		parts = append(parts, message.Topic)
+	}
+	if message.TenantId != "" {
+		parts = append(parts, "tenant "+message.TenantId)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// redactUrl drops the url of a client error, the urls of the chat apis hold their secrets
+func redactUrl(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
@@ -0,0 +1,462 @@
+package di
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Scope int
+
+const (
+	// Singleton components are created once per container
+	Singleton Scope = iota
+	// Tenant components are created once per tenant
+	Tenant
+	// Request components are created once per request scope
+	Request
+)
+
+func (s Scope) String() string {
+	switch s {
+	case Tenant:
+		return "tenant"
+	case Request:
+		return "request"
+	default:
+		return "singleton"
+	}
+}
+
+// TenantId is available in tenant and request scopes, constructors can depend on it
+type TenantId string
+
+// Starter components are started by Container.Start, in dependency order
+type Starter interface {
+	Start(ctx context.Context) error
+}
+
+// Stopper components are stopped in reverse dependency order when their scope ends: Container.Stop
+// for the singleton and tenant components, Container.Close for the request ones
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+type provider struct {
+	typ    reflect.Type
+	scope  Scope
+	fn     reflect.Value
+	params []reflect.Type
+	value  *reflect.Value
+	// unmanaged components are not started or stopped by the container
+	unmanaged bool
+}
+
+type Option func(p *provider)
+
+// Unmanaged excludes the component from Start and Stop, its lifecycle is handled by its owner
+func Unmanaged() Option {
+	return func(p *provider) {
+		p.unmanaged = true
+	}
+}
+
+// InScope sets the scope of the provided component, Singleton by default
+func InScope(scope Scope) Option {
+	return func(p *provider) {
+		p.scope = scope
+	}
+}
+
+// Container resolves components from constructors, constructors are functions whose parameters
+// are the dependencies and which return the component, optionally with an error.
+// Scoped containers (see Container.Scope) share the providers and singletons of their root.
+type Container struct {
+	root      *Container
+	scope     Scope
+	tenant    string
+	mu        sync.Mutex
+	providers map[reflect.Type]*provider
+	instances map[reflect.Type]reflect.Value
+	tenants   map[string]*Container
+	// created keeps the components of the scope in creation order for the lifecycle hooks
+	created []reflect.Value
+	started int
+}
+
+func New() *Container {
+	return &Container{
+		scope:     Singleton,
+		providers: map[reflect.Type]*provider{},
+		instances: map[reflect.Type]reflect.Value{},
+		tenants:   map[string]*Container{},
+	}
+}
+
+// Provide registers a constructor, the component type is the first return value
+func (c *Container) Provide(constructor any, opts ...Option) error {
+	fn := reflect.ValueOf(constructor)
+	if fn.Kind() != reflect.Func {
+		return fmt.Errorf("di: constructor must be a function, got %T", constructor)
+	}
+	t := fn.Type()
+	if t.NumOut() == 0 || t.NumOut() > 2 || (t.NumOut() == 2 && t.Out(1) != errorType) {
+		return fmt.Errorf("di: constructor %s must return a component and optionally an error", t)
+	}
+	p := &provider{typ: t.Out(0), fn: fn}
+	for i := 0; i < t.NumIn(); i++ {
+		p.params = append(p.params, t.In(i))
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return c.register(p, false)
+}
+
+// Supply registers an existing value as a singleton of its dynamic type, see the generic Supply to
+// register it as an interface. Supplied values are not started or stopped by the container.
+func (c *Container) Supply(value any) error {
+	if value == nil {
+		return errors.New("di: cannot supply a nil value")
+	}
+	v := reflect.ValueOf(value)
+	return c.register(&provider{typ: v.Type(), value: &v}, false)
+}
+
+// Override replaces the provider of a component (usually in tests), the value can be a constructor
+// or an instance. Instances already created for the component are discarded.
+func (c *Container) Override(constructorOrValue any, opts ...Option) error {
+	v := reflect.ValueOf(constructorOrValue)
+	if v.Kind() == reflect.Func {
+		tmp := New()
+		if err := tmp.Provide(constructorOrValue, opts...); err != nil {
+			return err
+		}
+		for _, p := range tmp.providers {
+			return c.register(p, true)
+		}
+	}
+	return c.register(&provider{typ: v.Type(), value: &v}, true)
+}
+
+func (c *Container) register(p *provider, override bool) error {
+	root := c.rootContainer()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	if _, exists := root.providers[p.typ]; exists && !override {
+		return fmt.Errorf("di: %s is already provided", p.typ)
+	}
+	root.providers[p.typ] = p
+	if override {
+		delete(root.instances, p.typ)
+		for _, tenant := range root.tenants {
+			delete(tenant.instances, p.typ)
+		}
+	}
+	return nil
+}
+
+// Has tells whether a provider is registered for the type
+func (c *Container) Has(t reflect.Type) bool {
+	root := c.rootContainer()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	_, ok := root.providers[t]
+	return ok
+}
+
+// Scope returns a request scope for the tenant, components of the Request scope are cached in it
+// and Tenant ones in the tenant scope shared by every request of the tenant
+func (c *Container) Scope(tenant string) *Container {
+	root := c.rootContainer()
+	return &Container{
+		root:      root,
+		scope:     Request,
+		tenant:    tenant,
+		instances: map[reflect.Type]reflect.Value{},
+	}
+}
+
+func (c *Container) rootContainer() *Container {
+	if c.root != nil {
+		return c.root
+	}
+	return c
+}
+
+func (c *Container) tenantContainer(tenant string) *Container {
+	root := c.rootContainer()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	tc, ok := root.tenants[tenant]
+	if !ok {
+		tc = &Container{root: root, scope: Tenant, tenant: tenant, instances: map[reflect.Type]reflect.Value{}}
+		root.tenants[tenant] = tc
+	}
+	return tc
+}
+
+// Resolve returns the component of the given type
+func (c *Container) Resolve(t reflect.Type) (reflect.Value, error) {
+	return c.resolve(t, nil)
+}
+
+func (c *Container) resolve(t reflect.Type, path []reflect.Type) (reflect.Value, error) {
+	for _, seen := range path {
+		if seen == t {
+			return reflect.Value{}, fmt.Errorf("di: dependency cycle %s", describePath(append(path, t)))
+		}
+	}
+	if t == reflect.TypeOf(TenantId("")) {
+		if c.scope == Singleton {
+			return reflect.Value{}, fmt.Errorf("di: %s requires a tenant or request scope", describePath(append(path, t)))
+		}
+		return reflect.ValueOf(TenantId(c.tenant)), nil
+	}
+	// a component gets the container of its own scope: the dependencies of a singleton are resolved
+	// from the root, so a singleton never captures a tenant or request scope
+	if t == reflect.TypeOf(c) {
+		return reflect.ValueOf(c), nil
+	}
+	c.mu.Lock()
+	if v, ok := c.instances[t]; ok {
+		c.mu.Unlock()
+		return v, nil
+	}
+	c.mu.Unlock()
+
+	root := c.rootContainer()
+	root.mu.Lock()
+	p, ok := root.providers[t]
+	root.mu.Unlock()
+	if !ok {
+		if len(path) > 0 {
+			return reflect.Value{}, fmt.Errorf("di: no provider for %s (required by %s)", t, describePath(path))
+		}
+		return reflect.Value{}, fmt.Errorf("di: no provider for %s", t)
+	}
+
+	// the container owning the instance depends on the scope of the component
+	var owner *Container
+	switch p.scope {
+	case Singleton:
+		owner = root
+	case Tenant:
+		if c.scope == Singleton {
+			return reflect.Value{}, fmt.Errorf("di: %s is %s scoped and cannot be resolved from the singleton scope (%s)", t, p.scope, describePath(append(path, t)))
+		}
+		owner = c.tenantContainer(c.tenant)
+	case Request:
+		if c.scope != Request {
+			return reflect.Value{}, fmt.Errorf("di: %s is %s scoped and cannot be resolved from the %s scope (%s)", t, p.scope, c.scope, describePath(append(path, t)))
+		}
+		owner = c
+	}
+
+	owner.mu.Lock()
+	if v, ok := owner.instances[t]; ok {
+		owner.mu.Unlock()
+		return v, nil
+	}
+	owner.mu.Unlock()
+
+	var value reflect.Value
+	if p.value != nil {
+		value = *p.value
+	} else {
+		args := make([]reflect.Value, 0, len(p.params))
+		for _, param := range p.params {
+			// dependencies are resolved from the scope of the component so that a singleton cannot
+			// capture a tenant or request component
+			arg, err := owner.resolve(param, append(path, t))
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			args = append(args, arg)
+		}
+		out := p.fn.Call(args)
+		if len(out) == 2 && !out[1].IsNil() {
+			return reflect.Value{}, fmt.Errorf("di: unable to create %s -- %w", t, out[1].Interface().(error))
+		}
+		value = out[0]
+	}
+
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+	if existing, ok := owner.instances[t]; ok {
+		return existing, nil
+	}
+	owner.instances[t] = value
+	// supplied values are owned by the caller, only the created components have a lifecycle
+	if p.value == nil && !p.unmanaged {
+		owner.created = append(owner.created, value)
+	}
+	return value, nil
+}
+
+// Invoke calls the function with its parameters resolved from the container, the error returned by
+// the function, if any, is returned
+func (c *Container) Invoke(fn any) ([]reflect.Value, error) {
+	f := reflect.ValueOf(fn)
+	if f.Kind() != reflect.Func {
+		return nil, fmt.Errorf("di: cannot invoke %T", fn)
+	}
+	args := make([]reflect.Value, 0, f.Type().NumIn())
+	for i := 0; i < f.Type().NumIn(); i++ {
+		arg, err := c.Resolve(f.Type().In(i))
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	out := f.Call(args)
+	if n := len(out); n > 0 && f.Type().Out(n-1) == errorType && !out[n-1].IsNil() {
+		return out, out[n-1].Interface().(error)
+	}
+	return out, nil
+}
+
+// Start creates every singleton then starts the Starter ones in dependency order
+func (c *Container) Start(ctx context.Context) error {
+	root := c.rootContainer()
+	root.mu.Lock()
+	types := make([]reflect.Type, 0, len(root.providers))
+	for t, p := range root.providers {
+		if p.scope == Singleton {
+			types = append(types, t)
+		}
+	}
+	root.mu.Unlock()
+	for _, t := range types {
+		if _, err := root.Resolve(t); err != nil {
+			return err
+		}
+	}
+
+	root.mu.Lock()
+	created := append([]reflect.Value{}, root.created...)
+	started := root.started
+	root.mu.Unlock()
+	for i := started; i < len(created); i++ {
+		if starter, ok := created[i].Interface().(Starter); ok {
+			if err := starter.Start(ctx); err != nil {
+				return fmt.Errorf("di: unable to start %s -- %w", created[i].Type(), err)
+			}
+		}
+		root.mu.Lock()
+		root.started = i + 1
+		root.mu.Unlock()
+	}
+	return nil
+}
+
+// Stop stops the Stopper components of the tenant scopes, which are discarded, then the singletons,
+// in reverse creation order. Every failure is reported.
+func (c *Container) Stop(ctx context.Context) error {
+	root := c.rootContainer()
+	root.mu.Lock()
+	created := append([]reflect.Value{}, root.created...)
+	names := make([]string, 0, len(root.tenants))
+	for name := range root.tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tenants := make([]*Container, 0, len(names))
+	for _, name := range names {
+		tenants = append(tenants, root.tenants[name])
+	}
+	root.tenants = map[string]*Container{}
+	root.started = 0
+	root.mu.Unlock()
+	var errs []error
+	for _, tenant := range tenants {
+		errs = append(errs, tenant.Close(ctx))
+	}
+	errs = append(errs, stopAll(ctx, created))
+	return errors.Join(errs...)
+}
+
+// Close ends a request scope (or a tenant scope): its Stopper components are stopped in reverse
+// creation order and its instances are discarded
+func (c *Container) Close(ctx context.Context) error {
+	if c.root == nil {
+		return errors.New("di: the root container is stopped with Stop")
+	}
+	c.mu.Lock()
+	created := c.created
+	c.created = nil
+	c.instances = map[reflect.Type]reflect.Value{}
+	c.mu.Unlock()
+	return stopAll(ctx, created)
+}
+
+func stopAll(ctx context.Context, created []reflect.Value) error {
+	var errs []error
+	for i := len(created) - 1; i >= 0; i-- {
+		if stopper, ok := created[i].Interface().(Stopper); ok {
+			if err := stopper.Stop(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("di: unable to stop %s -- %w", created[i].Type(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func describePath(path []reflect.Type) string {
+	names := make([]string, 0, len(path))
+	for _, t := range path {
+		names = append(names, t.String())
+	}
+	return strings.Join(names, " -> ")
+}
+
+// =================================================================================
+// GENERIC HELPERS
+// =================================================================================
+
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// Supply registers the value as a singleton of type T (which can be an interface)
+func Supply[T any](c *Container, value T) error {
+	v := reflect.ValueOf(&value).Elem()
+	return c.register(&provider{typ: typeOf[T](), value: &v}, false)
+}
+
+// Bind stores the value as a component of type T in this scope only (e.g. the current request)
+func Bind[T any](c *Container, value T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.instances[typeOf[T]()] = reflect.ValueOf(&value).Elem()
+}
+
+// Get resolves the component of type T
+func Get[T any](c *Container) (T, error) {
+	var result T
+	v, err := c.Resolve(typeOf[T]())
+	if err != nil {
+		return result, err
+	}
+	if v.IsValid() && v.CanInterface() {
+		if value, ok := v.Interface().(T); ok {
+			result = value
+		}
+	}
+	return result, nil
+}
+
+// MustGet resolves the component of type T and panics when it cannot be resolved
+func MustGet[T any](c *Container) T {
+	result, err := Get[T](c)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
@@ -0,0 +1,146 @@
+package di
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type config struct{ Url string }
+
+type repo struct {
+	cfg    *config
+	tenant TenantId
+}
+
+type service struct {
+	repo *repo
+	log  *[]string
+}
+
+func (s *service) Start(context.Context) error {
+	*s.log = append(*s.log, "start service")
+	return nil
+}
+
+func (s *service) Stop(context.Context) error {
+	*s.log = append(*s.log, "stop service")
+	return nil
+}
+
+type clock interface{ Now() int }
+
+type fixedClock struct{ value int }
+
+func (c fixedClock) Now() int { return c.value }
+
+type cycleA struct{}
+type cycleB struct{}
+
+func TestContainerScopes(t *testing.T) {
+	c := New()
+	calls := 0
+	assert.Nil(t, c.Provide(func() *config {
+		calls++
+		return &config{Url: "db://"}
+	}))
+	assert.Nil(t, c.Provide(func(cfg *config, tenant TenantId) *repo {
+		return &repo{cfg: cfg, tenant: tenant}
+	}, InScope(Tenant)))
+	assert.Nil(t, c.Provide(func(r *repo) *service { return &service{repo: r} }, InScope(Request)))
+
+	acme := c.Scope("acme")
+	s1 := MustGet[*service](acme)
+	assert.Equal(t, TenantId("acme"), s1.repo.tenant)
+	assert.Same(t, s1, MustGet[*service](acme))
+
+	other := c.Scope("acme")
+	s2 := MustGet[*service](other)
+	assert.NotSame(t, s1, s2)
+	assert.Same(t, s1.repo, s2.repo)
+	assert.NotSame(t, s1.repo, MustGet[*repo](c.Scope("globex")))
+	assert.Equal(t, 1, calls)
+
+	_, err := Get[*repo](c)
+	assert.EqualError(t, err, "di: *di.repo is tenant scoped and cannot be resolved from the singleton scope (*di.repo)")
+}
+
+func TestContainerErrors(t *testing.T) {
+	c := New()
+	assert.Nil(t, c.Provide(func(*cycleB) *cycleA { return nil }))
+	assert.Nil(t, c.Provide(func(*cycleA) *cycleB { return nil }))
+	_, err := Get[*cycleA](c)
+	assert.EqualError(t, err, "di: dependency cycle *di.cycleA -> *di.cycleB -> *di.cycleA")
+
+	assert.Nil(t, c.Provide(func(*config) *repo { return nil }))
+	_, err = Get[*repo](c)
+	assert.EqualError(t, err, "di: no provider for *di.config (required by *di.repo)")
+	assert.NotNil(t, c.Provide(func() *repo { return nil }))
+}
+
+func TestContainerLifecycleAndOverrides(t *testing.T) {
+	var log []string
+	c := New()
+	assert.Nil(t, Supply[clock](c, fixedClock{value: 1}))
+	assert.Nil(t, c.Provide(func() *config { return &config{} }))
+	assert.Nil(t, c.Provide(func(cfg *config) *repo { return &repo{cfg: cfg} }))
+	assert.Nil(t, c.Provide(func(r *repo) *service { return &service{repo: r, log: &log} }))
+
+	assert.Equal(t, 1, MustGet[clock](c).Now())
+	assert.Nil(t, c.Override(func() clock { return fixedClock{value: 2} }))
+	assert.Equal(t, 2, MustGet[clock](c).Now())
+
+	assert.Nil(t, c.Start(context.Background()))
+	assert.Nil(t, c.Stop(context.Background()))
+	assert.Equal(t, []string{"start service", "stop service"}, log)
+
+	out, err := c.Invoke(func(s *service, cl clock) int { return cl.Now() })
+	assert.Nil(t, err)
+	assert.Equal(t, 2, int(out[0].Int()))
+}
+
+type session struct {
+	name string
+	log  *[]string
+}
+
+func (s *session) Stop(context.Context) error {
+	*s.log = append(*s.log, "stop "+s.name)
+	return nil
+}
+
+type tenantPool struct{ session }
+
+type locator struct {
+	container *Container
+}
+
+func TestContainerScopedStoppers(t *testing.T) {
+	var log []string
+	c := New()
+	assert.Nil(t, c.Provide(func() *service { return &service{log: &log} }))
+	assert.Nil(t, c.Provide(func(tenant TenantId) *tenantPool {
+		return &tenantPool{session{name: "pool " + string(tenant), log: &log}}
+	}, InScope(Tenant)))
+	assert.Nil(t, c.Provide(func(_ *service, _ *tenantPool) *session {
+		return &session{name: "session", log: &log}
+	}, InScope(Request)))
+	assert.Nil(t, c.Provide(func(c *Container) *locator { return &locator{container: c} }))
+
+	// the request components are stopped when their scope is closed
+	scope := c.Scope("acme")
+	MustGet[*session](scope)
+	assert.Nil(t, scope.Close(context.Background()))
+	assert.Equal(t, []string{"stop session"}, log)
+	assert.NotNil(t, c.Close(context.Background()))
+
+	// singletons get the root container, even when resolved from a request scope
+	assert.Same(t, c, MustGet[*locator](c.Scope("acme")).container)
+
+	// the tenant components are stopped before the singletons, the tenant scopes are discarded
+	MustGet[*tenantPool](c.Scope("globex"))
+	pool := MustGet[*tenantPool](c.Scope("acme"))
+	assert.Nil(t, c.Stop(context.Background()))
+	assert.Equal(t, []string{"stop session", "stop pool acme", "stop pool globex", "stop service"}, log)
+	assert.NotSame(t, pool, MustGet[*tenantPool](c.Scope("acme")))
+}
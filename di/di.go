@@ -36,10 +36,16 @@ type Component interface {
 
 var registry = make(map[string]any)
 
+// Register adds a component to the global registry
+//
+// Deprecated: use the app Container
 func Register(name string, provider interface{}) {
 	registry[name] = provider
 }
 
+// Resolve returns the first registered component of type T
+//
+// Deprecated: use Get with the app Container
 func Resolve[T Component](typ T) *T {
 	rtype := reflect.TypeOf(typ)
 	for _, component := range registry {
@@ -51,10 +57,11 @@ func Resolve[T Component](typ T) *T {
 			return component.(*T)
 		}
 	}
-	log.Fatalf("failed to resolve component %s", typ)
+	log.Fatalf("failed to resolve component %v", typ)
 	return nil
 }
 
+// Deprecated: use Get with the app Container
 func ResolveByName[T interface{}](name string) T {
 	if component, ok := registry[name]; ok {
 		return component.(T)
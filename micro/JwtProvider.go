@@ -38,7 +38,7 @@ func (p *DefaultTokenProvider) Decode(token string, checkSignature bool) (map[st
 			return nil, errors.New("unexpected signing method")
 		}
 		return []byte(p.secret), nil
-	})
+	}, jwt.WithTimeFunc(dates.Now))
 
 	if err != nil && checkSignature {
 		return nil, errors.New("invalid_signature")
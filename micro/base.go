@@ -6,12 +6,15 @@ import (
 	"errors"
 	"github.com/labstack/echo/v4"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/qoalis/go-micro/di"
 	"github.com/qoalis/go-micro/schema"
+	"github.com/qoalis/go-micro/util/dates"
 	"github.com/qoalis/go-micro/util/h"
 	"github.com/redis/go-redis/v9"
 	log "github.com/sirupsen/logrus"
 	"net/http"
 	"reflect"
+	"time"
 )
 
 var DefaultTenantId = "public"
@@ -22,14 +25,40 @@ type Feature struct {
 	Configure   func(app *App)
 	MigrationFS *embed.FS
 	DependsOn   []Feature
+	// Routes registers the endpoints of the feature, it is skipped when the app has no router
+	Routes func(router Router)
+	// Jobs registers the scheduled jobs of the feature, it is skipped when the app has no scheduler
+	Jobs func(scheduler Scheduler)
+	// Subscriptions returns the event handlers of the feature by topic
+	Subscriptions func() map[string]SubscribeFunc
+	// OnStart is called before the server accepts requests, features are started in dependency order
+	OnStart func(ctx context.Context) error
+	// OnStop is called on shutdown in reverse dependency order, with StopTimeout (10s by default)
+	OnStop      func(ctx context.Context) error
+	StopTimeout time.Duration
+	// HealthCheck is a required component of the readiness check, named after the feature
+	HealthCheck func(ctx context.Context) error
 }
 
 type App struct {
-	Name              string
-	Version           string
-	Env               *Env
+	Name    string
+	Version string
+	Env     *Env
+	// ShutdownTimeout bounds the whole shutdown, DefaultShutdownTimeout by default
+	ShutdownTimeout time.Duration
+	// DrainDelay is the time given to the load balancers to notice the failing readiness check
+	// before the server stops accepting requests
+	DrainDelay time.Duration
+	// ShutdownListeners are called in reverse registration order once the app is stopped
 	ShutdownListeners []func()
 	Router            Router
+	Container         *di.Container
+	// Metadata is published with the instance of the app in the service registry
+	Metadata map[string]string
+	// features are kept in configuration (dependency) order for the lifecycle hooks
+	features     []Feature
+	started      int
+	registration *ServiceHeartbeat
 }
 
 type AuthToken struct {
@@ -87,6 +116,7 @@ type Ctx struct {
 
 type Env struct {
 	Ctx
+	// Conf is the typed configuration bound from Cfg.Config, see Config[T]
 	Conf        interface{}
 	AppName     string
 	AppVersion  string
@@ -101,9 +131,17 @@ type Env struct {
 	Production          bool
 	TenantLoader        TenantLoader
 	Localizer           *i18n.Localizer
+	LocaleBundle        *i18n.Bundle
+	DefaultLocale       string
 	RedisClient         *redis.Client
+	Cache               Cache
+	Flags               FlagProvider
+	HealthChecks        []HealthCheck
+	Health              *HealthProbe
+	Registry            ServiceRegistry
 	DiscoverySericeName string
 	DiscoveryServiceUrl string
+	Container           *di.Container
 }
 
 type AppCfg struct {
@@ -152,6 +190,17 @@ func (ctx Ctx) CurrentDB() DataSource {
 	return ctx.db
 }
 
+// DB returns the datasource of the current transaction or of the current tenant, nil when there is none
+func (ctx Ctx) DB() DataSource {
+	if ctx.db != nil {
+		return ctx.db
+	}
+	if ctx.Env == nil || ctx.Env.DataSources == nil {
+		return nil
+	}
+	return ctx.Env.DataSources[ctx.TenantId]
+}
+
 func (ctx Ctx) IsAuthenticated() bool {
 	if ctx.Auth == nil {
 		return false
@@ -172,6 +221,20 @@ func (ctx Ctx) Authenticate(auth Authentication, tenant string) error {
 	return nil
 }
 
+// UseClock sets the clock of the dates package (tokens, scheduler, caches), nil restores the wall
+// clock. The scheduler is told so that a fake clock drives its jobs.
+func (e *Env) UseClock(clock dates.Clock) {
+	dates.SetClock(clock)
+	if scheduler, ok := e.Scheduler.(ClockAware); ok {
+		scheduler.UseClock(dates.CurrentClock())
+	}
+}
+
+// Now returns the current time according to the clock of the dates package
+func (e *Env) Now() time.Time {
+	return dates.Now()
+}
+
 // SharedDB @deprecated
 func (e Env) SharedDB() DataSource {
 	return e.DefaultDB()
@@ -265,6 +328,17 @@ func (ctx Ctx) RequestWithValue(key string, value any) *http.Request {
 	return req.WithContext(context.WithValue(req.Context(), key, value))
 }
 
+// AfterHandler registers a callback invoked, in reverse order, once the route handler has returned
+func (ctx Ctx) AfterHandler(fn func(err error)) {
+	e := ctx.Wrapped
+	if e == nil {
+		return
+	}
+	c := e.(echo.Context)
+	callbacks, _ := c.Get(AfterHandlersKey).([]func(error))
+	c.Set(AfterHandlersKey, append(callbacks, fn))
+}
+
 func (ctx Ctx) Request() *http.Request {
 	e := ctx.Wrapped
 	if e == nil {
@@ -0,0 +1,101 @@
+package micro
+
+import (
+	"github.com/qoalis/go-micro/util/dates"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// RequestOutcome is the result of a request sent to an address
+type RequestOutcome int
+
+const (
+	RequestSucceeded RequestOutcome = iota
+	RequestFailed
+	// RequestAbandoned is a request cancelled by the client, it tells nothing about the address
+	RequestAbandoned
+)
+
+// CircuitBreaker stops sending requests to an address after Threshold consecutive failures. Once the
+// Cooldown is over, a single trial request is let through: it closes the circuit when it succeeds
+// and opens it again when it fails.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	mu        sync.Mutex
+	failures  int
+	openedAt  time.Time
+	trial     bool
+}
+
+func (b *CircuitBreaker) threshold() int {
+	if b.Threshold <= 0 {
+		return DefaultBreakerThreshold
+	}
+	return b.Threshold
+}
+
+func (b *CircuitBreaker) cooldown() time.Duration {
+	if b.Cooldown <= 0 {
+		return DefaultBreakerCooldown
+	}
+	return b.Cooldown
+}
+
+// Open tells whether the requests are currently rejected
+func (b *CircuitBreaker) Open() bool {
+	return !b.ready(dates.Now())
+}
+
+func (b *CircuitBreaker) ready(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold() {
+		return true
+	}
+	return !b.trial && !now.Before(b.openedAt.Add(b.cooldown()))
+}
+
+// begin is called when a request is sent, it tells whether the request took the trial of a
+// half-open circuit
+func (b *CircuitBreaker) begin() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures >= b.threshold() && !b.trial {
+		b.trial = true
+		return true
+	}
+	return false
+}
+
+// Done records the outcome of a request that did not take the trial
+func (b *CircuitBreaker) Done(outcome RequestOutcome) {
+	b.done(outcome, false)
+}
+
+// done records the outcome of a request, only the trial request ends the trial: the requests sent
+// before the circuit opened do not let another one through. An abandoned trial lets the next
+// request try again.
+func (b *CircuitBreaker) done(outcome RequestOutcome, trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if trial {
+		b.trial = false
+	}
+	switch outcome {
+	case RequestAbandoned:
+		return
+	case RequestSucceeded:
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold() {
+		b.openedAt = dates.Now()
+	}
+}
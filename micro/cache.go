@@ -2,43 +2,172 @@ package micro
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"github.com/allegro/bigcache/v3"
+	"github.com/qoalis/go-micro/util/dates"
 	"github.com/qoalis/go-micro/util/h"
 	log "github.com/sirupsen/logrus"
+	"strings"
 	"time"
 )
 
+// Cache stores JSON serializable values. Keys are namespaced by the ctx tenant.
+// A ttl of 0 uses the default ttl of the implementation.
 type Cache interface {
+	Get(ctx Ctx, key string, target any) (bool, error)
+	Set(ctx Ctx, key string, value any, ttl time.Duration) error
+	Delete(ctx Ctx, keys ...string) error
+	DeleteByPrefix(ctx Ctx, prefix string) error
+}
+
+const DefaultCacheTTL = 5 * time.Minute
+
+// localCacheLifeWindow bounds the lifetime of local entries, whatever their ttl
+const localCacheLifeWindow = 24 * time.Hour
+
+// CacheKey returns the key namespaced with the ctx tenant
+func CacheKey(ctx Ctx, key string) string {
+	tenant := ctx.TenantId
+	if tenant == "" {
+		tenant = DefaultTenantId
+	}
+	return tenant + ":" + key
+}
+
+// Remember returns the cached value for key or stores the result of populate
+func Remember(ctx Ctx, cache Cache, key string, ttl time.Duration, target any, populate func() (any, error)) error {
+	if !h.IsPointer(target) {
+		log.Fatal("target must be a pointer")
+		return nil
+	}
+	if found, err := cache.Get(ctx, key, target); err == nil && found {
+		return nil
+	}
+	data, err := populate()
+	if err != nil {
+		return err
+	}
+	if err = cache.Set(ctx, key, data, ttl); err != nil {
+		log.Warnf("unable to cache %s: %s", key, err)
+	}
+	return h.CopyAllFields(target, data, false)
+}
+
+// LegacyCache is the cache interface before Get received the context, AdaptCache serves it from
+// a Cache for the existing callers.
+//
+// Deprecated: use Remember, or Get and Set
+type LegacyCache interface {
 	Get(target interface{}, key string, populate func() (interface{}, error)) error
 }
 
-type DefaultCache struct {
+type legacyCache struct {
+	next Cache
+}
+
+// AdaptCache wraps a Cache, e.g. var cache micro.LegacyCache = micro.AdaptCache(micro.NewCache(ttl)).
+// The keys are stored in the namespace of the default tenant with the default ttl.
+//
+// Deprecated: use Remember, or Get and Set
+func AdaptCache(cache Cache) LegacyCache {
+	return legacyCache{next: cache}
+}
+
+func (c legacyCache) Get(target interface{}, key string, populate func() (interface{}, error)) error {
+	return Remember(NewCtx(nil, DefaultTenantId), c.next, key, 0, target, populate)
+}
+
+// =================================================================================
+// LOCAL CACHE
+// =================================================================================
+
+type LocalCache struct {
 	Cache
 	internal *bigcache.BigCache
+	ttl      time.Duration
 }
 
-func NewCache(ttl time.Duration) Cache {
-	cache, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(ttl))
-	return DefaultCache{
+// cacheEntry carries its own expiry so that entries follow the configured dates.Clock
+type cacheEntry struct {
+	ExpiresAt time.Time       `json:"expires_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// NewCache creates an in-process cache, entries never outlive 24h
+func NewCache(ttl time.Duration) *LocalCache {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	window := localCacheLifeWindow
+	if ttl > window {
+		window = ttl
+	}
+	cache, _ := bigcache.New(context.Background(), bigcache.DefaultConfig(window))
+	return &LocalCache{
 		internal: cache,
+		ttl:      ttl,
 	}
 }
 
-func (c DefaultCache) Get(target interface{}, key string, populate func() (interface{}, error)) error {
-	if !h.IsPointer(target) {
-		log.Fatal("target must be a pointer")
-		return nil
+func (c *LocalCache) Get(ctx Ctx, key string, target any) (bool, error) {
+	value, err := c.internal.Get(CacheKey(ctx, key))
+	if errors.Is(err, bigcache.ErrEntryNotFound) {
+		return false, nil
 	}
-	if value, err := c.internal.Get(key); err == nil {
-		return h.DeserializeJsonBytes(value, target)
-	} else {
-		data, err := populate()
-		if err == nil {
-			if serialized, err := h.ToJsonBytes(data); err == nil {
-				_ = c.internal.Set(key, serialized)
-			}
-			return h.CopyAllFields(target, data, false)
-		}
+	if err != nil {
+		return false, err
+	}
+	var entry cacheEntry
+	if err = h.DeserializeJsonBytes(value, &entry); err != nil {
+		return false, err
+	}
+	if !dates.Now().Before(entry.ExpiresAt) {
+		_ = c.internal.Delete(CacheKey(ctx, key))
+		return false, nil
+	}
+	return true, h.DeserializeJsonBytes(entry.Data, target)
+}
+
+func (c *LocalCache) Set(ctx Ctx, key string, value any, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = c.ttl
+	}
+	serialized, err := h.ToJsonBytes(value)
+	if err != nil {
 		return err
 	}
+	entry, err := h.ToJsonBytes(cacheEntry{ExpiresAt: dates.NowPlus(ttl), Data: serialized})
+	if err != nil {
+		return err
+	}
+	return c.internal.Set(CacheKey(ctx, key), entry)
+}
+
+func (c *LocalCache) Delete(ctx Ctx, keys ...string) error {
+	for _, key := range keys {
+		if err := c.internal.Delete(CacheKey(ctx, key)); err != nil && !errors.Is(err, bigcache.ErrEntryNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *LocalCache) DeleteByPrefix(ctx Ctx, prefix string) error {
+	namespaced := CacheKey(ctx, prefix)
+	keys := make([]string, 0)
+	it := c.internal.Iterator()
+	for it.SetNext() {
+		entry, err := it.Value()
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(entry.Key(), namespaced) {
+			keys = append(keys, entry.Key())
+		}
+	}
+	for _, key := range keys {
+		_ = c.internal.Delete(key)
+	}
+	return nil
 }
@@ -0,0 +1,74 @@
+package micro
+
+import (
+	"errors"
+	"github.com/qoalis/go-micro/util/dates"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLocalCache(t *testing.T) {
+	clock := dates.NewFakeClock()
+	dates.SetClock(clock)
+	defer dates.SetClock(nil)
+
+	cache := NewCache(time.Minute)
+	acme := NewCtx(nil, "acme")
+	globex := NewCtx(nil, "globex")
+
+	assert.Nil(t, cache.Set(acme, "users:1", "alice", 0))
+	assert.Nil(t, cache.Set(acme, "users:2", "bob", time.Hour))
+	assert.Nil(t, cache.Set(acme, "roles:1", "admin", 0))
+
+	var value string
+	found, err := cache.Get(acme, "users:1", &value)
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "alice", value)
+
+	// keys are scoped by tenant
+	found, _ = cache.Get(globex, "users:1", &value)
+	assert.False(t, found)
+
+	// per-key ttl
+	clock.Advance(2 * time.Minute)
+	found, _ = cache.Get(acme, "users:1", &value)
+	assert.False(t, found)
+	found, _ = cache.Get(acme, "users:2", &value)
+	assert.True(t, found)
+
+	assert.Nil(t, cache.DeleteByPrefix(acme, "users:"))
+	found, _ = cache.Get(acme, "users:2", &value)
+	assert.False(t, found)
+	found, _ = cache.Get(acme, "roles:1", &value)
+	assert.False(t, found, "roles:1 expired with the default ttl")
+}
+
+func TestAdaptCache(t *testing.T) {
+	cache := NewCache(time.Minute)
+	legacy := AdaptCache(cache)
+	calls := 0
+	populate := func() (interface{}, error) {
+		calls++
+		return "alice", nil
+	}
+
+	var value string
+	assert.Nil(t, legacy.Get(&value, "users:1", populate))
+	assert.Nil(t, legacy.Get(&value, "users:1", populate))
+	assert.Equal(t, "alice", value)
+	assert.Equal(t, 1, calls)
+
+	// the values are shared with the default tenant of the cache
+	found, err := cache.Get(NewCtx(nil, DefaultTenantId), "users:1", &value)
+	assert.Nil(t, err)
+	assert.True(t, found)
+
+	// the populate errors are returned and nothing is cached
+	assert.Equal(t, errors.New("down"), legacy.Get(&value, "users:2", func() (interface{}, error) {
+		return nil, errors.New("down")
+	}))
+	found, _ = cache.Get(NewCtx(nil, DefaultTenantId), "users:2", &value)
+	assert.False(t, found)
+}
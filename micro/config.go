@@ -0,0 +1,330 @@
+package micro
+
+import (
+	"encoding"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ConfigError lists every missing or invalid configuration key
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// ConfigFiles are looked up at the root of the FS, the files of the current environment
+// (config.<GO_ENV>.toml, development by default) are applied on top of the base ones
+var ConfigFiles = []string{"config.toml", "config.yaml", "config.yml"}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// LoadConfig binds the target struct (a pointer) from, by increasing priority: the `default` tags,
+// the config files found in fsys and the env variables, or the <KEY>_FILE secret files when the
+// variables are unset.
+//
+// Env keys default to the upper snake case of the field name and can be set with the `env` tag,
+// nested structs prefix the keys of their fields (e.g. DB_HOST). The keys of the config files are
+// mapped to the same keys: database_url, DatabaseUrl and [db] host are read as DATABASE_URL and
+// DB_HOST, unknown keys are reported. Fields tagged `required:"true"` must be set and `validate`
+// tags are checked with the validator package. Every problem is reported at once in a ConfigError.
+func LoadConfig(target any, fsys fs.FS) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config target must be a pointer to a struct, got %T", target)
+	}
+	loader := &configLoader{validate: validator.New()}
+	loader.walk(v.Elem(), "", loader.applyDefault)
+	if fsys != nil {
+		files := loader.loadFiles(fsys)
+		loader.walk(v.Elem(), "", func(_ reflect.StructField, value reflect.Value, key string) {
+			loader.applyFile(files, value, key)
+		})
+		// the values left were bound to no field
+		unknown := make([]string, 0, len(files))
+		for _, entry := range files {
+			unknown = append(unknown, entry.file+": unknown key "+entry.path)
+		}
+		sort.Strings(unknown)
+		loader.problems = append(loader.problems, unknown...)
+	}
+	loader.walk(v.Elem(), "", loader.applyEnv)
+	loader.walk(v.Elem(), "", loader.check)
+	if len(loader.problems) > 0 {
+		return &ConfigError{Problems: loader.problems}
+	}
+	return nil
+}
+
+// Config returns the typed configuration of the application, see Cfg.Config
+func Config[T any](ctx Ctx) *T {
+	if ctx.Env == nil {
+		return nil
+	}
+	conf, _ := ctx.Env.Conf.(*T)
+	return conf
+}
+
+type configLoader struct {
+	validate *validator.Validate
+	problems []string
+}
+
+func (l *configLoader) fail(format string, args ...any) {
+	l.problems = append(l.problems, fmt.Sprintf(format, args...))
+}
+
+// fileValue is a value of a config file with its location, for the error messages
+type fileValue struct {
+	file  string
+	path  string
+	value any
+}
+
+// loadFiles reads the values of the config files by key, the later files override the former
+func (l *configLoader) loadFiles(fsys fs.FS) map[string]fileValue {
+	environment := os.Getenv("GO_ENV")
+	if environment == "" {
+		environment = "development"
+	}
+	files := append([]string{}, ConfigFiles...)
+	for _, file := range ConfigFiles {
+		ext := file[strings.LastIndex(file, "."):]
+		files = append(files, strings.TrimSuffix(file, ext)+"."+environment+ext)
+	}
+	values := map[string]fileValue{}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			continue
+		}
+		content := map[string]any{}
+		if strings.HasSuffix(file, ".toml") {
+			err = toml.Unmarshal(data, &content)
+		} else {
+			err = yaml.Unmarshal(data, &content)
+		}
+		if err != nil {
+			l.fail("%s: %v", file, err)
+			continue
+		}
+		flattenConfig(file, "", "", content, values)
+	}
+	return values
+}
+
+// flattenConfig indexes the values of the nested tables by the env key of their path
+func flattenConfig(file string, path string, prefix string, content map[string]any, values map[string]fileValue) {
+	for k, v := range content {
+		key := prefix + upperSnake(k)
+		location := k
+		if path != "" {
+			location = path + "." + k
+		}
+		if nested, ok := v.(map[string]any); ok {
+			flattenConfig(file, location, key+"_", nested, values)
+			continue
+		}
+		values[key] = fileValue{file: file, path: location, value: v}
+	}
+}
+
+func (l *configLoader) applyFile(files map[string]fileValue, value reflect.Value, key string) {
+	entry, ok := files[key]
+	if !ok {
+		return
+	}
+	delete(files, key)
+	if err := setFileValue(value, entry.value); err != nil {
+		l.fail("%s: invalid value of %s -- %v", entry.file, entry.path, err)
+	}
+}
+
+func setFileValue(value reflect.Value, raw any) error {
+	if items, ok := raw.([]any); ok && value.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(value.Type(), 0, len(items))
+		for _, item := range items {
+			elem := reflect.New(value.Type().Elem()).Elem()
+			if err := setConfigValue(elem, fileString(item)); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		value.Set(slice)
+		return nil
+	}
+	return setConfigValue(value, fileString(raw))
+}
+
+func fileString(value any) string {
+	if t, ok := value.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// walk calls fn for every leaf field with its env key
+func (l *configLoader) walk(v reflect.Value, prefix string, fn func(field reflect.StructField, value reflect.Value, key string)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Tag.Get("env")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = upperSnake(field.Name)
+		}
+		value := v.Field(i)
+		if isNestedConfig(field.Type) {
+			l.walk(value, prefix+name+"_", fn)
+			continue
+		}
+		fn(field, value, prefix+name)
+	}
+}
+
+func (l *configLoader) applyDefault(field reflect.StructField, value reflect.Value, key string) {
+	if def, ok := field.Tag.Lookup("default"); ok {
+		if err := setConfigValue(value, def); err != nil {
+			l.fail("%s: invalid default %q -- %v", key, def, err)
+		}
+	}
+}
+
+func (l *configLoader) applyEnv(_ reflect.StructField, value reflect.Value, key string) {
+	raw, ok := os.LookupEnv(key)
+	if !ok {
+		file := os.Getenv(key + "_FILE")
+		if file == "" {
+			return
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			l.fail("%s_FILE: %v", key, err)
+			return
+		}
+		raw = strings.TrimRight(string(data), "\r\n")
+	}
+	if err := setConfigValue(value, raw); err != nil {
+		l.fail("%s: invalid value %q -- %v", key, raw, err)
+	}
+}
+
+func (l *configLoader) check(field reflect.StructField, value reflect.Value, key string) {
+	if field.Tag.Get("required") == "true" && value.IsZero() {
+		l.fail("%s is required", key)
+		return
+	}
+	if rules := field.Tag.Get("validate"); rules != "" {
+		if err := l.validate.Var(value.Interface(), rules); err != nil {
+			for _, fe := range err.(validator.ValidationErrors) {
+				if fe.Param() != "" {
+					l.fail("%s must satisfy %s=%s", key, fe.Tag(), fe.Param())
+				} else {
+					l.fail("%s must satisfy %s", key, fe.Tag())
+				}
+			}
+		}
+	}
+}
+
+func isNestedConfig(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+func setConfigValue(value reflect.Value, raw string) error {
+	if value.CanAddr() && value.Addr().Type().Implements(textUnmarshalerType) {
+		return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw))
+	}
+	if value.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	case reflect.Slice:
+		items := strings.Split(raw, ",")
+		slice := reflect.MakeSlice(value.Type(), 0, len(items))
+		for _, item := range items {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			elem := reflect.New(value.Type().Elem()).Elem()
+			if err := setConfigValue(elem, item); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		value.Set(slice)
+	case reflect.Pointer:
+		elem := reflect.New(value.Type().Elem())
+		if err := setConfigValue(elem.Elem(), raw); err != nil {
+			return err
+		}
+		value.Set(elem)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+// upperSnake converts DatabaseUrl to DATABASE_URL
+func upperSnake(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
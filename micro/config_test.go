@@ -0,0 +1,92 @@
+package micro
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type testConfig struct {
+	DatabaseUrl string        `required:"true"`
+	Port        int           `default:"8080" validate:"min=1,max=65535"`
+	Timeout     time.Duration `default:"5s"`
+	Origins     []string
+	ApiKey      string
+	Mailer      struct {
+		From string `env:"SENDER" validate:"omitempty,email"`
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "api_key")
+	require.NoError(t, os.WriteFile(secret, []byte("s3cr3t\n"), 0o600))
+	t.Setenv("GO_ENV", "")
+	t.Setenv("PORT", "9090")
+	t.Setenv("ORIGINS", "a.com, b.com")
+	t.Setenv("API_KEY_FILE", secret)
+
+	fsys := fstest.MapFS{
+		"config.toml":             {Data: []byte("DatabaseUrl = \"postgres://base\"\n[Mailer]\nsender = \"noreply@example.com\"\n")},
+		"config.development.yaml": {Data: []byte("timeout: 10s\n")},
+	}
+	var cfg testConfig
+	require.NoError(t, LoadConfig(&cfg, fsys))
+	assert.Equal(t, "postgres://base", cfg.DatabaseUrl)
+	assert.Equal(t, 9090, cfg.Port)
+	assert.Equal(t, 10*time.Second, cfg.Timeout)
+	assert.Equal(t, []string{"a.com", "b.com"}, cfg.Origins)
+	assert.Equal(t, "s3cr3t", cfg.ApiKey)
+	assert.Equal(t, "noreply@example.com", cfg.Mailer.From)
+
+	ctx := Ctx{Env: &Env{Conf: &cfg}}
+	assert.Same(t, &cfg, Config[testConfig](ctx))
+
+	// every problem is reported at once
+	t.Setenv("PORT", "0")
+	t.Setenv("MAILER_SENDER", "nope")
+	t.Setenv("TIMEOUT", "forever")
+	err := LoadConfig(&testConfig{}, nil)
+	var configErr *ConfigError
+	require.ErrorAs(t, err, &configErr)
+	assert.Len(t, configErr.Problems, 4)
+	assert.Contains(t, err.Error(), "DATABASE_URL is required")
+	assert.Contains(t, err.Error(), "PORT must satisfy min=1")
+	assert.Contains(t, err.Error(), "MAILER_SENDER must satisfy email")
+}
+
+func TestLoadConfigFileKeys(t *testing.T) {
+	t.Setenv("GO_ENV", "")
+	fsys := fstest.MapFS{
+		"config.yaml": {Data: []byte("database_url: postgres://yaml\norigins: [a.com, b.com]\nmailer:\n  sender: noreply@example.com\n")},
+	}
+
+	// the file keys are the env keys, whatever their case
+	var cfg testConfig
+	require.NoError(t, LoadConfig(&cfg, fsys))
+	assert.Equal(t, "postgres://yaml", cfg.DatabaseUrl)
+	assert.Equal(t, []string{"a.com", "b.com"}, cfg.Origins)
+	assert.Equal(t, "noreply@example.com", cfg.Mailer.From)
+
+	// the env variables override the files and win over the secret files
+	secret := filepath.Join(t.TempDir(), "database_url")
+	require.NoError(t, os.WriteFile(secret, []byte("postgres://secret\n"), 0o600))
+	t.Setenv("DATABASE_URL_FILE", secret)
+	cfg = testConfig{}
+	require.NoError(t, LoadConfig(&cfg, fsys))
+	assert.Equal(t, "postgres://secret", cfg.DatabaseUrl)
+	t.Setenv("DATABASE_URL", "postgres://env")
+	cfg = testConfig{}
+	require.NoError(t, LoadConfig(&cfg, fsys))
+	assert.Equal(t, "postgres://env", cfg.DatabaseUrl)
+
+	// the unknown keys and the field names replaced by an env tag are rejected
+	fsys["config.development.toml"] = &fstest.MapFile{Data: []byte("prot = 80\n[mailer]\nfrom = \"noreply@example.com\"\n")}
+	err := LoadConfig(&testConfig{}, fsys)
+	var configErr *ConfigError
+	require.ErrorAs(t, err, &configErr)
+	assert.Equal(t, []string{"config.development.toml: unknown key mailer.from", "config.development.toml: unknown key prot"}, configErr.Problems)
+}
@@ -13,5 +13,7 @@ const InsecureJwtDev = "INSECURE_JWT_DEV"
 const ServerToken = "SERVER_TOKEN"
 const EmailSender = "EMAIL_SENDER"
 const NotificationSender = "NOTIFICATION_SENDER"
+const NotificationDedupeWindow = "NOTIFICATION_DEDUPE_WINDOW"
 const RedisUrl = "REDIS_URL"
+const CacheTTL = "CACHE_TTL"
 const SessionKey = "SESSION_SECRET"
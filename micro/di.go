@@ -1,2 +1,69 @@
 package micro
 
+import (
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/qoalis/go-micro/di"
+	"github.com/redis/go-redis/v9"
+)
+
+// ScopeKey is the key of the request di scope in the echo context
+const ScopeKey = "di_scope"
+
+// ErrNoContainer is returned when resolving a component from a context without env container
+var ErrNoContainer = errors.New("no_di_container")
+
+// provideDefaults registers the env components in the container. Components are provided lazily so
+// that features can still replace them (e.g. a queued mailer) before they are resolved. They are
+// unmanaged, the app handles their lifecycle (see App.Shutdown).
+func provideDefaults(app *App) {
+	c := app.Container
+	_ = di.Supply(c, app)
+	_ = di.Supply(c, app.Env)
+	_ = c.Provide(func(env *Env) Scheduler { return env.Scheduler }, di.Unmanaged())
+	_ = c.Provide(func(env *Env) TokenProvider { return env.TokenProvider }, di.Unmanaged())
+	_ = c.Provide(func(env *Env) Mailer { return env.Mailer }, di.Unmanaged())
+	_ = c.Provide(func(env *Env) NotificationService { return env.Notifier }, di.Unmanaged())
+	_ = c.Provide(func(env *Env) Cache { return env.Cache }, di.Unmanaged())
+	_ = c.Provide(func(env *Env) FlagProvider { return env.Flags }, di.Unmanaged())
+	_ = c.Provide(func(env *Env) ServiceRegistry { return env.Registry }, di.Unmanaged())
+	_ = c.Provide(func(env *Env) *redis.Client { return env.RedisClient }, di.Unmanaged())
+	// the datasource follows the context, it is the transaction of the handler when there is one
+	_ = c.Provide(func(ctx Ctx) (DataSource, error) {
+		if db := ctx.DB(); db != nil {
+			return db, nil
+		}
+		return nil, errors.New("missing_db_tenant")
+	}, di.InScope(di.Request))
+}
+
+// Scope returns the di scope of the context, it is shared by the whole request when the context
+// wraps one and closed by the router at the end of the request. Otherwise a new scope is returned
+// and the caller closes it. The context itself can be resolved from the scope.
+func (ctx Ctx) Scope() *di.Container {
+	if ctx.Env == nil || ctx.Env.Container == nil {
+		return nil
+	}
+	if c, ok := ctx.Wrapped.(echo.Context); ok {
+		if scope, ok := c.Get(ScopeKey).(*di.Container); ok {
+			return scope
+		}
+		scope := ctx.Env.Container.Scope(ctx.TenantId)
+		di.Bind(scope, ctx)
+		c.Set(ScopeKey, scope)
+		return scope
+	}
+	scope := ctx.Env.Container.Scope(ctx.TenantId)
+	di.Bind(scope, ctx)
+	return scope
+}
+
+// Resolve returns the component of type T from the context scope
+func Resolve[T any](ctx Ctx) (T, error) {
+	scope := ctx.Scope()
+	if scope == nil {
+		var zero T
+		return zero, ErrNoContainer
+	}
+	return di.Get[T](scope)
+}
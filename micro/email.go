@@ -1,24 +1,207 @@
 package micro
 
 import (
+	"errors"
+	"fmt"
+	"github.com/qoalis/go-micro/schema"
 	"github.com/qoalis/go-micro/util/h"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"time"
 )
 
 type EmailAddress struct {
 	Name    string
 	Address string
+	// Primary marks the main recipient of the email (see Email.PrimaryRecipient)
 	Primary bool
 }
 
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+	// Upload is downloaded when Content is empty
+	Upload *schema.Upload
+	// Inline attachments are embedded in the html body and referenced with cid:<ContentId>
+	Inline    bool
+	ContentId string
+}
+
 type Email struct {
-	From         *EmailAddress
-	To           []EmailAddress
-	Subject      string
-	Body         string
+	From    *EmailAddress
+	To      []EmailAddress
+	Cc      []EmailAddress
+	Bcc     []EmailAddress
+	ReplyTo *EmailAddress
+	Subject string
+	// Deprecated: use HtmlBody
+	Body     string
+	HtmlBody string
+	TextBody string
+	// Headers are added as is to the message
+	Headers map[string]string
+	// Categories are used by the providers to tag and group the emails
+	Categories   []string
+	Attachments  []EmailAttachment
 	TemplateId   string
 	TemplateData h.Map
+	// Locale selects the localized variant of local templates, defaults to the app locale
+	Locale string
+	// MessageKey identifies the email for queued mailers, an email is queued only once per key
+	MessageKey string
 }
 
 type Mailer interface {
+	Send(ctx Ctx, message Email) error
+}
+
+// BatchMailer is implemented by the mailers able to deliver several emails at once
+type BatchMailer interface {
+	Mailer
+	SendBatch(ctx Ctx, messages []Email) error
+}
+
+// LegacyMailer is the mailer interface before Send received the context, AdaptMailer turns
+// the existing implementations into a Mailer
+type LegacyMailer interface {
 	Send(message Email) error
 }
+
+type legacyMailer struct {
+	next LegacyMailer
+}
+
+// AdaptMailer wraps a LegacyMailer, e.g. env.Mailer = micro.AdaptMailer(myMailer)
+func AdaptMailer(mailer LegacyMailer) Mailer {
+	return legacyMailer{next: mailer}
+}
+
+func (m legacyMailer) Send(_ Ctx, message Email) error {
+	return m.next.Send(message)
+}
+
+// SendEmails delivers the messages with SendBatch when the mailer is a BatchMailer, one by one
+// otherwise
+func SendEmails(ctx Ctx, mailer Mailer, messages []Email) error {
+	if batch, ok := mailer.(BatchMailer); ok {
+		return batch.SendBatch(ctx, messages)
+	}
+	var errs []error
+	for _, message := range messages {
+		errs = append(errs, mailer.Send(ctx, message))
+	}
+	return errors.Join(errs...)
+}
+
+// Html returns the html body, falling back to the deprecated Body
+func (e Email) Html() string {
+	if e.HtmlBody != "" {
+		return e.HtmlBody
+	}
+	return e.Body
+}
+
+// PrimaryRecipient returns the To address flagged as primary or the first one
+func (e Email) PrimaryRecipient() *EmailAddress {
+	for i := range e.To {
+		if e.To[i].Primary {
+			return &e.To[i]
+		}
+	}
+	if len(e.To) > 0 {
+		return &e.To[0]
+	}
+	return nil
+}
+
+// Recipients returns the addresses of every To, Cc and Bcc recipient
+func (e Email) Recipients() []string {
+	result := make([]string, 0, len(e.To)+len(e.Cc)+len(e.Bcc))
+	for _, list := range [][]EmailAddress{e.To, e.Cc, e.Bcc} {
+		for _, addr := range list {
+			result = append(result, addr.Address)
+		}
+	}
+	return result
+}
+
+var attachmentsClient = &http.Client{Timeout: 30 * time.Second}
+
+// Load returns the attachment with its content downloaded from the upload url when needed and
+// its filename and content type completed
+func (a EmailAttachment) Load() (EmailAttachment, error) {
+	if a.Upload != nil {
+		if a.Filename == "" {
+			a.Filename = a.Upload.Name
+		}
+		if a.Filename == "" {
+			a.Filename = path.Base(a.Upload.Url)
+		}
+		if a.ContentType == "" {
+			a.ContentType = a.Upload.Mime
+		}
+	}
+	if len(a.Content) == 0 && a.Upload != nil {
+		res, err := attachmentsClient.Get(a.Upload.Url)
+		if err != nil {
+			return a, fmt.Errorf("unable to download attachment %s -- %v", a.Upload.Url, err)
+		}
+		//goland:noinspection ALL
+		defer res.Body.Close()
+		if res.StatusCode >= 300 {
+			return a, fmt.Errorf("unable to download attachment %s -- status %d", a.Upload.Url, res.StatusCode)
+		}
+		if a.Content, err = io.ReadAll(res.Body); err != nil {
+			return a, err
+		}
+		if a.ContentType == "" {
+			a.ContentType = res.Header.Get("Content-Type")
+		}
+	}
+	if a.ContentType == "" {
+		a.ContentType = mime.TypeByExtension(path.Ext(a.Filename))
+	}
+	if a.ContentType == "" {
+		a.ContentType = http.DetectContentType(a.Content)
+	}
+	if a.Inline && a.ContentId == "" {
+		a.ContentId = a.Filename
+	}
+	return a, nil
+}
+
+// LoadAttachments loads every attachment of the message, see EmailAttachment.Load
+func (e Email) LoadAttachments() ([]EmailAttachment, error) {
+	result := make([]EmailAttachment, 0, len(e.Attachments))
+	for _, attachment := range e.Attachments {
+		loaded, err := attachment.Load()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, loaded)
+	}
+	return result, nil
+}
+
+// MailerError is returned by the mailers when the provider rejects an email
+type MailerError struct {
+	Provider   string
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *MailerError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%s: %s (status %d, code %s)", e.Provider, e.Message, e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("%s: %s (status %d)", e.Provider, e.Message, e.StatusCode)
+}
+
+// Retryable tells whether the failure is transient (throttling or provider outage)
+func (e *MailerError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,25 @@
+package micro
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type legacyRecorder struct {
+	subjects []string
+}
+
+func (r *legacyRecorder) Send(message Email) error {
+	r.subjects = append(r.subjects, message.Subject)
+	return nil
+}
+
+func TestAdaptMailer(t *testing.T) {
+	recorder := &legacyRecorder{}
+	mailer := AdaptMailer(recorder)
+	assert.Nil(t, mailer.Send(NewCtx(nil, DefaultTenantId), Email{Subject: "one"}))
+
+	// mailers without SendBatch deliver the emails one by one
+	assert.Nil(t, SendEmails(NewCtx(nil, DefaultTenantId), mailer, []Email{{Subject: "two"}, {Subject: "three"}}))
+	assert.Equal(t, []string{"one", "two", "three"}, recorder.subjects)
+}
@@ -1,8 +1,12 @@
 package micro
 
 import (
+	"context"
+	"fmt"
 	"github.com/asaskevich/EventBus"
 	"github.com/google/martian/v3/log"
+	"sync"
+	"sync/atomic"
 )
 
 var impl = EventBus.New()
@@ -16,42 +20,139 @@ type Event struct {
 
 type SubscribeFunc = func(ctx Ctx, payload Event) error
 
+// PublishHook is invoked for every published event, before subscribers are notified
+type PublishHook = func(ctx Ctx, topic string, payload Event)
+
+var (
+	asyncWg      sync.WaitGroup
+	syncDelivery atomic.Bool
+	// busMu guards busClosed and the additions to asyncWg so that none happens once DrainEvents waits
+	busMu        sync.Mutex
+	busClosed    bool
+	hooksMu      sync.RWMutex
+	hooksSeq     int
+	publishHooks = map[int]PublishHook{}
+)
+
 func Subscribe(topic string, handle SubscribeFunc) error {
 	//ctx := micro.CurrentContext()
 	return impl.Subscribe(topic, func(ctx Ctx, payload Event) {
-		if err := handle(ctx, payload); err != nil {
-			log.Errorf("error handling event: %s", err)
-		}
+		deliver(handle, ctx, payload)
 	})
 }
 
 func SubscribeAsync(topic string, handle SubscribeFunc) error {
-	//return impl.SubscribeAsync(topic, handle, false)
-	return impl.SubscribeAsync(topic, func(ctx Ctx, payload Event) {
-		if err := handle(ctx, payload); err != nil {
-			log.Errorf("error handling event: %s", err)
+	return impl.Subscribe(topic, func(ctx Ctx, payload Event) {
+		if syncDelivery.Load() {
+			deliver(handle, ctx, payload)
+			return
+		}
+		busMu.Lock()
+		if busClosed {
+			busMu.Unlock()
+			log.Errorf("event bus is closed, dropping event for %s", topic)
+			return
 		}
-	}, false)
+		asyncWg.Add(1)
+		busMu.Unlock()
+		go func() {
+			defer asyncWg.Done()
+			deliver(handle, ctx, payload)
+		}()
+	})
 }
 
+func deliver(handle SubscribeFunc, ctx Ctx, payload Event) {
+	if err := handle(ctx, payload); err != nil {
+		log.Errorf("error handling event: %s", err)
+	}
+}
+
+// SetSyncDelivery makes async subscribers run inline with Publish, which keeps tests deterministic.
+// The setting is process wide, the previous value is returned so that it can be restored.
+func SetSyncDelivery(enabled bool) bool {
+	return syncDelivery.Swap(enabled)
+}
+
+// OnPublish registers a hook called for every published event and returns a function removing it
+func OnPublish(hook PublishHook) func() {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooksSeq++
+	id := hooksSeq
+	publishHooks[id] = hook
+	return func() {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+		delete(publishHooks, id)
+	}
+}
+
+// SendNotification publishes the notification, it is delivered by env.Notifier
 func SendNotification(ctx Ctx, event Notification) {
+	if event.TenantId == "" {
+		event.TenantId = ctx.TenantId
+	}
 	Publish(ctx, NotificationTopic, Event{
-		Event: event.Message,
+		Subject: event.Topic,
+		Event:   event.Message,
+		Data:    event,
 	})
 }
 
 func Publish(ctx Ctx, topic string, payload Event) {
+	if isBusClosed() {
+		log.Errorf("event bus is closed, dropping event %s", topic)
+		return
+	}
 	if payload.Error != "" {
 		log.Errorf(payload.Error)
 	}
+	hooksMu.RLock()
+	hooks := make([]PublishHook, 0, len(publishHooks))
+	for _, hook := range publishHooks {
+		hooks = append(hooks, hook)
+	}
+	hooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(ctx, topic, payload)
+	}
 	impl.Publish(topic, ctx, payload)
 }
 
+func isBusClosed() bool {
+	busMu.Lock()
+	defer busMu.Unlock()
+	return busClosed
+}
+
 func WaitAsync() {
 	impl.WaitAsync()
+	asyncWg.Wait()
+}
+
+// DrainEvents closes the bus to new events and waits for the async subscribers until ctx is done
+func DrainEvents(ctx context.Context) error {
+	busMu.Lock()
+	busClosed = true
+	busMu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		WaitAsync()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("event subscribers still running -- %w", ctx.Err())
+	}
 }
 
 func Reset() {
-	impl.WaitAsync()
+	WaitAsync()
 	impl = EventBus.New()
+	busMu.Lock()
+	busClosed = false
+	busMu.Unlock()
 }
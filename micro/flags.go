@@ -0,0 +1,283 @@
+package micro
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pelletier/go-toml/v2"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FlagChangedTopic is published when a flag is saved or deleted, Event.Subject is the flag name
+// and Event.Data the Flag
+const FlagChangedTopic = "feature_flag.changed"
+
+// FlagEnvPrefix is the prefix of the env variables read by NewEnvFlags
+const FlagEnvPrefix = "FLAG_"
+
+// FlagFiles are looked up at the root of the FS by NewApp, they define a `flags` list
+var FlagFiles = []string{"flags.toml", "flags.yaml", "flags.yml", "flags.json"}
+
+// Flag is a feature flag definition. A disabled flag is off for everyone, an enabled flag without
+// rules is on for everyone, otherwise it is on for the contexts matching one of its rules.
+type Flag struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Enabled     bool       `json:"enabled"`
+	Variant     string     `json:"variant,omitempty"`
+	Rules       []FlagRule `json:"rules,omitempty"`
+}
+
+// FlagRule matches a context when every criterion set matches, the first matching rule wins
+type FlagRule struct {
+	Tenants []string `json:"tenants,omitempty"`
+	Users   []string `json:"users,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+	// Percentage of the users (or tenants for anonymous requests) the rule applies to, nil means
+	// all and 0 nobody. Buckets are stable: a user keeps the same answer while the percentage grows.
+	Percentage *int `json:"percentage,omitempty"`
+	// Variant overrides the flag variant for the matching contexts
+	Variant string `json:"variant,omitempty"`
+}
+
+// FlagValue is the result of a flag evaluation
+type FlagValue struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Variant string `json:"variant,omitempty"`
+}
+
+// Is tells whether the flag is on with the given variant
+func (v FlagValue) Is(variant string) bool {
+	return v.Enabled && v.Variant == variant
+}
+
+type FlagProvider interface {
+	// Flag returns the flag for the context tenant, nil when it is not defined
+	Flag(ctx Ctx, name string) (*Flag, error)
+	Flags(ctx Ctx) ([]Flag, error)
+}
+
+// FlagStore is a FlagProvider whose flags can be changed at runtime
+type FlagStore interface {
+	FlagProvider
+	SaveFlag(ctx Ctx, flag Flag) error
+	DeleteFlag(ctx Ctx, name string) error
+}
+
+// Evaluate evaluates the flag against the context
+func (f *Flag) Evaluate(ctx Ctx) FlagValue {
+	value := FlagValue{Name: f.Name}
+	if !f.Enabled {
+		return value
+	}
+	if len(f.Rules) == 0 {
+		value.Enabled = true
+		value.Variant = f.Variant
+		return value
+	}
+	for _, rule := range f.Rules {
+		if rule.matches(ctx, f.Name) {
+			value.Enabled = true
+			value.Variant = f.Variant
+			if rule.Variant != "" {
+				value.Variant = rule.Variant
+			}
+			return value
+		}
+	}
+	return value
+}
+
+func (r FlagRule) matches(ctx Ctx, flag string) bool {
+	if len(r.Tenants) > 0 && !containsString(r.Tenants, ctx.TenantId) {
+		return false
+	}
+	var user string
+	var roles []string
+	if ctx.Auth != nil && ctx.Auth.Authenticated {
+		user = ctx.Auth.UserId
+		roles = ctx.Auth.Roles
+	}
+	if len(r.Users) > 0 && (user == "" || !containsString(r.Users, user)) {
+		return false
+	}
+	if len(r.Roles) > 0 {
+		found := false
+		for _, role := range roles {
+			if containsString(r.Roles, role) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.Percentage != nil && *r.Percentage < 100 {
+		subject := user
+		if subject == "" {
+			subject = ctx.TenantId
+		}
+		if flagBucket(flag, subject) >= *r.Percentage {
+			return false
+		}
+	}
+	return true
+}
+
+// flagBucket hashes the subject into [0, 100), the flag name is part of the hash so that the
+// same users are not always the first to get every feature
+func flagBucket(flag string, subject string) int {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(flag + ":" + subject))
+	return int(hash.Sum32() % 100)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Flag evaluates the feature flag for the current context, undefined flags and provider failures
+// are evaluated as disabled
+func (ctx Ctx) Flag(name string) FlagValue {
+	if ctx.Env == nil || ctx.Env.Flags == nil {
+		return FlagValue{Name: name}
+	}
+	flag, err := ctx.Env.Flags.Flag(ctx, name)
+	if err != nil {
+		log.Errorf("unable to load flag %s -- %v", name, err)
+		return FlagValue{Name: name}
+	}
+	if flag == nil {
+		return FlagValue{Name: name}
+	}
+	return flag.Evaluate(ctx)
+}
+
+// FlagEnabled is a shortcut for ctx.Flag(name).Enabled
+func (ctx Ctx) FlagEnabled(name string) bool {
+	return ctx.Flag(name).Enabled
+}
+
+// =================================================================================
+// MEMORY FLAGS
+// =================================================================================
+
+// MemoryFlags keeps the flags in memory, it is shared by every tenant
+type MemoryFlags struct {
+	FlagStore
+	mu    sync.RWMutex
+	flags map[string]Flag
+}
+
+func NewMemoryFlags(flags ...Flag) *MemoryFlags {
+	m := &MemoryFlags{flags: map[string]Flag{}}
+	for _, flag := range flags {
+		m.flags[flag.Name] = flag
+	}
+	return m
+}
+
+// NewEnvFlags reads the FLAG_<NAME> env variables: true/false toggle the flag, a percentage
+// (e.g. 25%) rolls it out progressively and any other value enables it with that variant.
+// Flag names are the lower case variable suffix (FLAG_NEW_CHECKOUT is new_checkout).
+func NewEnvFlags(flags ...Flag) *MemoryFlags {
+	m := NewMemoryFlags(flags...)
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(key, FlagEnvPrefix) || len(key) == len(FlagEnvPrefix) {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(key, FlagEnvPrefix))
+		flag := Flag{Name: name, Enabled: true}
+		if enabled, err := strconv.ParseBool(value); err == nil {
+			flag.Enabled = enabled
+		} else if percentage, err := strconv.Atoi(strings.TrimSuffix(value, "%")); err == nil && strings.HasSuffix(value, "%") {
+			flag.Rules = []FlagRule{{Percentage: &percentage}}
+		} else {
+			flag.Variant = value
+		}
+		m.flags[name] = flag
+	}
+	return m
+}
+
+// LoadFlagFile reads the flags list of a toml, yaml or json file
+func LoadFlagFile(fsys fs.FS, file string) ([]Flag, error) {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+	var content struct {
+		Flags []Flag `json:"flags" toml:"flags" yaml:"flags"`
+	}
+	switch path.Ext(file) {
+	case ".toml":
+		err = toml.Unmarshal(data, &content)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &content)
+	case ".json":
+		err = json.Unmarshal(data, &content)
+	default:
+		err = fmt.Errorf("unsupported flags file %s", file)
+	}
+	return content.Flags, err
+}
+
+func (m *MemoryFlags) Flag(_ Ctx, name string) (*Flag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if flag, ok := m.flags[name]; ok {
+		return &flag, nil
+	}
+	return nil, nil
+}
+
+func (m *MemoryFlags) Flags(_ Ctx) ([]Flag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	flags := make([]Flag, 0, len(m.flags))
+	for _, flag := range m.flags {
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags, nil
+}
+
+func (m *MemoryFlags) SaveFlag(ctx Ctx, flag Flag) error {
+	m.mu.Lock()
+	m.flags[flag.Name] = flag
+	m.mu.Unlock()
+	PublishFlagChange(ctx, "saved", flag)
+	return nil
+}
+
+func (m *MemoryFlags) DeleteFlag(ctx Ctx, name string) error {
+	m.mu.Lock()
+	flag, ok := m.flags[name]
+	delete(m.flags, name)
+	m.mu.Unlock()
+	if ok {
+		PublishFlagChange(ctx, "deleted", flag)
+	}
+	return nil
+}
+
+// PublishFlagChange publishes a FlagChangedTopic event, action is saved or deleted
+func PublishFlagChange(ctx Ctx, action string, flag Flag) {
+	Publish(ctx, FlagChangedTopic, Event{Subject: flag.Name, Event: action, Data: flag})
+}
@@ -0,0 +1,30 @@
+package micro
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFlagPercentage(t *testing.T) {
+	t.Setenv("FLAG_NOBODY", "0%")
+	t.Setenv("FLAG_HALF", "50%")
+	t.Setenv("FLAG_EVERYONE", "100%")
+	flags := NewEnvFlags(Flag{Name: "all", Enabled: true, Rules: []FlagRule{{Tenants: []string{"acme"}}}})
+
+	enabled := map[string]int{}
+	for i := 0; i < 200; i++ {
+		ctx := Ctx{TenantId: "acme", Auth: &Authentication{Authenticated: true, UserId: fmt.Sprintf("user_%d", i)}}
+		for _, name := range []string{"nobody", "half", "everyone", "all"} {
+			flag, err := flags.Flag(ctx, name)
+			assert.Nil(t, err)
+			if flag.Evaluate(ctx).Enabled {
+				enabled[name]++
+			}
+		}
+	}
+	assert.Equal(t, 0, enabled["nobody"])
+	assert.InDelta(t, 100, enabled["half"], 30)
+	assert.Equal(t, 200, enabled["everyone"])
+	assert.Equal(t, 200, enabled["all"])
+}
@@ -0,0 +1,197 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qoalis/go-micro/schema"
+	"github.com/qoalis/go-micro/util/dates"
+	"golang.org/x/sync/singleflight"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultHealthTimeout  = 2 * time.Second
+	DefaultHealthCacheTTL = 5 * time.Second
+)
+
+// Pinger is implemented by the components whose reachability can be probed, e.g. mailers and
+// notifiers, they are reported by the readiness check when they implement it
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthCheck is a component of the readiness check, the component is down when Check fails
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+	// Optional components are reported without failing the readiness check
+	Optional bool
+	// Timeout defaults to HealthConfig.Timeout
+	Timeout time.Duration
+}
+
+type HealthConfig struct {
+	// Timeout of every probe, defaults to 2s
+	Timeout time.Duration
+	// CacheTTL is how long the readiness result is reused, defaults to 5s. It protects the
+	// components from aggressive orchestrator probes.
+	CacheTTL time.Duration
+	// ShowDetails reports the errors of the components in the readiness response. They can reveal
+	// internal addresses and are hidden by default, DetailsAllowed can show them per request,
+	// e.g. for the administrators.
+	ShowDetails    bool
+	DetailsAllowed func(r *http.Request) bool
+}
+
+// HealthProbe runs the readiness checks: the tenant datasources, redis, the mailer and the notifier
+// when they are Pinger, and the env.HealthChecks. Checks run in parallel and the result is cached.
+type HealthProbe struct {
+	env      *Env
+	cfg      HealthConfig
+	group    singleflight.Group
+	mu       sync.Mutex
+	cached   *schema.HealthStatus
+	expires  time.Time
+	draining atomic.Bool
+}
+
+func NewHealthProbe(env *Env, cfg HealthConfig) *HealthProbe {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultHealthTimeout
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = DefaultHealthCacheTTL
+	}
+	return &HealthProbe{env: env, cfg: cfg}
+}
+
+// Live tells whether the process is able to serve, it does not probe any dependency so that an
+// orchestrator does not restart the app because a database is down
+func (p *HealthProbe) Live() *schema.HealthStatus {
+	return schema.NewHealthStatus()
+}
+
+// Ready returns the status of every component, the status is DOWN when a required one is down
+func (p *HealthProbe) Ready(ctx context.Context) *schema.HealthStatus {
+	if p.draining.Load() {
+		status := schema.NewHealthStatus()
+		status.SetComponentStatus("shutdown", errors.New("draining"))
+		return status
+	}
+	p.mu.Lock()
+	if p.cached != nil && dates.Now().Before(p.expires) {
+		status := p.cached
+		p.mu.Unlock()
+		return status
+	}
+	p.mu.Unlock()
+	result, _, _ := p.group.Do("ready", func() (any, error) {
+		// probes are detached from the request so that a cancelled probe does not poison the cache
+		status := p.run(context.WithoutCancel(ctx))
+		p.mu.Lock()
+		p.cached = status
+		p.expires = dates.Now().Add(p.cfg.CacheTTL)
+		p.mu.Unlock()
+		return status, nil
+	})
+	return result.(*schema.HealthStatus)
+}
+
+// ShowDetails tells whether the errors of the components can be reported to the request
+func (p *HealthProbe) ShowDetails(r *http.Request) bool {
+	return p.cfg.ShowDetails || (p.cfg.DetailsAllowed != nil && p.cfg.DetailsAllowed(r))
+}
+
+// Drain makes the readiness check fail so that the traffic is routed away before the shutdown
+func (p *HealthProbe) Drain() {
+	p.draining.Store(true)
+}
+
+// Invalidate drops the cached readiness result
+func (p *HealthProbe) Invalidate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cached = nil
+}
+
+func (p *HealthProbe) run(ctx context.Context) *schema.HealthStatus {
+	checks := p.checks()
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check HealthCheck) {
+			defer wg.Done()
+			errs[i] = p.probe(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+	status := schema.NewHealthStatus()
+	for i, check := range checks {
+		if check.Optional {
+			status.SetOptionalComponentStatus(check.Name, errs[i])
+		} else {
+			status.SetComponentStatus(check.Name, errs[i])
+		}
+	}
+	return status
+}
+
+// probe runs the check with its timeout, a check ignoring its context is abandoned
+func (p *HealthProbe) probe(ctx context.Context, check HealthCheck) (err error) {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = p.cfg.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("health check panicked: %v", r)
+			}
+		}()
+		done <- check.Check(ctx)
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timeout after %s", timeout)
+	}
+}
+
+func (p *HealthProbe) checks() []HealthCheck {
+	env := p.env
+	var checks []HealthCheck
+	tenants := make([]string, 0, len(env.DataSources))
+	for tenant := range env.DataSources {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	for _, tenant := range tenants {
+		ds := env.DataSources[tenant]
+		checks = append(checks, HealthCheck{Name: "db:" + tenant, Check: func(context.Context) error {
+			return ds.Ping()
+		}})
+	}
+	if env.RedisClient != nil {
+		checks = append(checks, HealthCheck{Name: "redis", Check: func(ctx context.Context) error {
+			return env.RedisClient.Ping(ctx).Err()
+		}})
+	}
+	// emails and notifications are not needed to serve requests
+	if pinger, ok := env.Mailer.(Pinger); ok {
+		checks = append(checks, HealthCheck{Name: "mailer", Check: pinger.Ping, Optional: true})
+	}
+	if pinger, ok := env.Notifier.(Pinger); ok {
+		checks = append(checks, HealthCheck{Name: "notifier", Check: pinger.Ping, Optional: true})
+	}
+	return append(checks, env.HealthChecks...)
+}
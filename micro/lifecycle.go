@@ -0,0 +1,167 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// DefaultShutdownTimeout bounds App.Shutdown when App.ShutdownTimeout is not set
+const DefaultShutdownTimeout = 30 * time.Second
+
+// DefaultStopTimeout bounds the OnStop hook of a feature and the stop of the container components
+const DefaultStopTimeout = 10 * time.Second
+
+// registerFeature wires the registration points of a configured feature
+func registerFeature(app *App, feat Feature) {
+	env := app.Env
+	if feat.Routes != nil && app.Router != nil {
+		feat.Routes(app.Router)
+	}
+	if feat.Jobs != nil {
+		if env.Scheduler == nil {
+			log.Warnf("feature %s has jobs but the app has no scheduler, skipping", feat.Name)
+		} else {
+			feat.Jobs(env.Scheduler)
+		}
+	}
+	if feat.Subscriptions != nil {
+		for topic, handler := range feat.Subscriptions() {
+			if err := Subscribe(topic, handler); err != nil {
+				log.Fatalf("feature %s is unable to subscribe to %s -- %v", feat.Name, topic, err)
+			}
+		}
+	}
+	if feat.HealthCheck != nil {
+		env.HealthChecks = append(env.HealthChecks, HealthCheck{Name: feat.Name, Check: feat.HealthCheck})
+	}
+	app.features = append(app.features, feat)
+}
+
+// AddHealthCheck adds a component to the readiness check
+func (app *App) AddHealthCheck(check HealthCheck) {
+	app.Env.HealthChecks = append(app.Env.HealthChecks, check)
+}
+
+// Start checks the route handlers, starts the container components then the features in
+// dependency order. When a feature fails to start, the features already started are stopped.
+func (app *App) Start(ctx context.Context) error {
+	if checker, ok := app.Router.(HandlerChecker); ok {
+		if err := checker.CheckHandlers(); err != nil {
+			return fmt.Errorf("invalid route handlers -- %w", err)
+		}
+	}
+	if app.Container != nil {
+		if err := app.Container.Start(ctx); err != nil {
+			return err
+		}
+	}
+	for app.started < len(app.features) {
+		feat := app.features[app.started]
+		if feat.OnStart != nil {
+			if err := feat.OnStart(ctx); err != nil {
+				err = fmt.Errorf("unable to start feature %s -- %w", feat.Name, err)
+				if stopErr := app.Stop(ctx); stopErr != nil {
+					log.Error(stopErr)
+				}
+				return err
+			}
+			log.Infof("feature %s started", feat.Name)
+		}
+		app.started++
+	}
+	return nil
+}
+
+// Stop stops the started features in reverse dependency order, then the container components and
+// finally runs the shutdown listeners. Every failure is reported.
+func (app *App) Stop(ctx context.Context) error {
+	var errs []error
+	for ; app.started > 0; app.started-- {
+		feat := app.features[app.started-1]
+		if feat.OnStop == nil {
+			continue
+		}
+		if err := stopFeature(ctx, feat); err != nil {
+			errs = append(errs, fmt.Errorf("unable to stop feature %s -- %w", feat.Name, err))
+		}
+	}
+	if app.Container != nil {
+		stopCtx, cancel := context.WithTimeout(ctx, DefaultStopTimeout)
+		errs = append(errs, app.Container.Stop(stopCtx))
+		cancel()
+	}
+	for i := len(app.ShutdownListeners) - 1; i >= 0; i-- {
+		app.ShutdownListeners[i]()
+	}
+	app.ShutdownListeners = nil
+	return errors.Join(errs...)
+}
+
+// stopFeature gives up waiting for the OnStop hook once its timeout is reached
+func stopFeature(ctx context.Context, feat Feature) error {
+	timeout := feat.StopTimeout
+	if timeout <= 0 {
+		timeout = DefaultStopTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- feat.OnStop(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown tears the app down in order: the instance is deregistered, the readiness check fails
+// and, after the DrainDelay, the router stops accepting requests and waits for the in-flight ones. Then the scheduler waits for
+// its running jobs, the event bus is drained, the features and components are stopped and the
+// databases are closed. The whole shutdown is bounded by ShutdownTimeout.
+func (app *App) Shutdown() error {
+	timeout := app.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+	// the instance leaves the registry first so that the clients stop picking it
+	if err := app.deregister(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("unable to deregister the service -- %w", err))
+	}
+	env := app.Env
+	if env.Health != nil {
+		env.Health.Drain()
+		if app.DrainDelay > 0 {
+			log.Infof("draining for %s", app.DrainDelay)
+			select {
+			case <-time.After(app.DrainDelay):
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	if app.Router != nil {
+		if err := app.Router.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("unable to stop the router -- %w", err))
+		}
+	}
+	if env.Scheduler != nil {
+		errs = append(errs, env.Scheduler.Stop(ctx))
+	}
+	// the subscribers may still use the components, they are drained before the features stop
+	errs = append(errs, DrainEvents(ctx))
+	errs = append(errs, app.Stop(ctx))
+	if env.DataSources != nil {
+		env.Close()
+	}
+	return errors.Join(errs...)
+}
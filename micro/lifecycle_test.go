@@ -0,0 +1,72 @@
+package micro
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFeatureLifecycle(t *testing.T) {
+	SetSyncDelivery(true)
+	t.Cleanup(func() {
+		SetSyncDelivery(false)
+		Reset()
+	})
+	var calls []string
+	feature := func(name string, deps ...Feature) Feature {
+		return Feature{
+			Name:      name,
+			DependsOn: deps,
+			OnStart: func(ctx context.Context) error {
+				calls = append(calls, "start:"+name)
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				calls = append(calls, "stop:"+name)
+				return nil
+			},
+		}
+	}
+	db := feature("db")
+	cache := feature("cache", db)
+	slow := feature("slow", cache)
+	slow.StopTimeout = 10 * time.Millisecond
+	slow.OnStop = func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}
+	slow.HealthCheck = func(ctx context.Context) error { return errors.New("down") }
+	slow.Subscriptions = func() map[string]SubscribeFunc {
+		return map[string]SubscribeFunc{"slow.topic": func(ctx Ctx, payload Event) error {
+			calls = append(calls, "event:"+payload.Event)
+			return nil
+		}}
+	}
+
+	app := &App{Env: &Env{}}
+	app.AddShutdownListener(func() { calls = append(calls, "listener:1") })
+	app.AddShutdownListener(func() { calls = append(calls, "listener:2") })
+	app.Init([]Feature{slow, db})
+	assert.Len(t, app.Env.HealthChecks, 1)
+	assert.Equal(t, "slow", app.Env.HealthChecks[0].Name)
+
+	assert.Nil(t, app.Start(context.Background()))
+	Publish(Ctx{}, "slow.topic", Event{Event: "ping"})
+	err := app.Stop(context.Background())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, []string{
+		"start:db", "start:cache", "start:slow", "event:ping",
+		"stop:cache", "stop:db", "listener:2", "listener:1",
+	}, calls)
+
+	// a failing feature stops the features already started
+	calls = nil
+	broken := feature("broken", db)
+	broken.OnStart = func(ctx context.Context) error { return errors.New("boom") }
+	app = &App{Env: &Env{}}
+	app.Init([]Feature{broken})
+	assert.ErrorContains(t, app.Start(context.Background()), "unable to start feature broken -- boom")
+	assert.Equal(t, []string{"start:db", "stop:db"}, calls)
+}
@@ -1,11 +1,75 @@
 package micro
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/qoalis/go-micro/util/dates"
 	log "github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
 )
 
+type Severity string
+
+const (
+	SeverityDebug    Severity = "debug"
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityError    Severity = "error"
+	SeverityCritical Severity = "critical"
+)
+
+var severityLevels = map[Severity]int{
+	SeverityDebug:    0,
+	SeverityInfo:     1,
+	SeverityWarning:  2,
+	SeverityError:    3,
+	SeverityCritical: 4,
+}
+
+// Level returns the rank of the severity, an empty or unknown severity is considered as info
+func (s Severity) Level() int {
+	if level, ok := severityLevels[Severity(strings.ToLower(string(s)))]; ok {
+		return level
+	}
+	return severityLevels[SeverityInfo]
+}
+
+func (s Severity) AtLeast(min Severity) bool {
+	return s.Level() >= min.Level()
+}
+
+type NotificationField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type NotificationLink struct {
+	Label string `json:"label"`
+	Url   string `json:"url"`
+}
+
 type Notification struct {
-	Message string `json:"content"`
+	Title    string              `json:"title,omitempty"`
+	Message  string              `json:"content"`
+	Severity Severity            `json:"severity,omitempty"`
+	Topic    string              `json:"topic,omitempty"`
+	Fields   []NotificationField `json:"fields,omitempty"`
+	Links    []NotificationLink  `json:"links,omitempty"`
+	TenantId string              `json:"tenantId,omitempty"`
+	// DedupeKey groups repeated notifications, defaults to the topic, title and message
+	DedupeKey string `json:"dedupeKey,omitempty"`
+}
+
+// Key returns the deduplication key of the notification
+func (n Notification) Key() string {
+	if n.DedupeKey != "" {
+		return n.TenantId + "|" + n.DedupeKey
+	}
+	return strings.Join([]string{n.TenantId, n.Topic, n.Title, n.Message}, "|")
 }
 
 type NotificationService interface {
@@ -24,3 +88,173 @@ func (n *NoopNotificationService) Send(_ Ctx, message Notification) error {
 	log.Warnf("no notifier configured -- message: %s", message.Message)
 	return nil
 }
+
+// NotificationChannel is a notifier receiving the notifications of at least MinSeverity and, when
+// Topics is set, only the ones of these topics ("*" matches every topic, "billing.*" a prefix)
+type NotificationChannel struct {
+	Name        string
+	Service     NotificationService
+	MinSeverity Severity
+	Topics      []string
+}
+
+func (c NotificationChannel) Accepts(message Notification) bool {
+	if c.MinSeverity != "" && !message.Severity.AtLeast(c.MinSeverity) {
+		return false
+	}
+	if len(c.Topics) == 0 {
+		return true
+	}
+	for _, topic := range c.Topics {
+		if topic == "*" || topic == message.Topic {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(topic, "*"); ok && strings.HasPrefix(message.Topic, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationRouter fans notifications out to every channel accepting them
+type NotificationRouter struct {
+	NotificationService
+	channels []NotificationChannel
+}
+
+func NewNotificationRouter(channels ...NotificationChannel) *NotificationRouter {
+	return &NotificationRouter{channels: channels}
+}
+
+func (r *NotificationRouter) Add(channel NotificationChannel) {
+	r.channels = append(r.channels, channel)
+}
+
+func (r *NotificationRouter) Channels() []NotificationChannel {
+	return r.channels
+}
+
+func (r *NotificationRouter) Send(ctx Ctx, message Notification) error {
+	var errs []error
+	for _, channel := range r.channels {
+		if !channel.Accepts(message) {
+			continue
+		}
+		if err := channel.Service.Send(ctx, message); err != nil {
+			log.Errorf("notification channel %s failed -- %v", channel.Name, err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ping probes the channels whose service is a Pinger
+func (r *NotificationRouter) Ping(ctx context.Context) error {
+	var errs []error
+	for _, channel := range r.channels {
+		if pinger, ok := channel.Service.(Pinger); ok {
+			if err := pinger.Ping(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("%s -- %w", channel.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DefaultNotificationDedupeWindow is the window used by NewNotificationDeduper when none is given
+const DefaultNotificationDedupeWindow = 5 * time.Minute
+
+type dedupeEntry struct {
+	first      time.Time
+	last       Notification
+	suppressed int
+}
+
+// NotificationDeduper sends the first notification of a key (see Notification.Key) and suppresses
+// the repeated ones until the window is over. A summary of the suppressed notifications is then
+// sent by Flush, or before the next notification of the same key.
+type NotificationDeduper struct {
+	NotificationService
+	next    NotificationService
+	window  time.Duration
+	mu      sync.Mutex
+	entries map[string]*dedupeEntry
+}
+
+func NewNotificationDeduper(next NotificationService, window time.Duration) *NotificationDeduper {
+	if window <= 0 {
+		window = DefaultNotificationDedupeWindow
+	}
+	return &NotificationDeduper{next: next, window: window, entries: map[string]*dedupeEntry{}}
+}
+
+func (d *NotificationDeduper) Ping(ctx context.Context) error {
+	if pinger, ok := d.next.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (d *NotificationDeduper) Send(ctx Ctx, message Notification) error {
+	if message.TenantId == "" {
+		message.TenantId = ctx.TenantId
+	}
+	key := message.Key()
+	now := dates.Now()
+
+	d.mu.Lock()
+	entry, found := d.entries[key]
+	if found && now.Sub(entry.first) < d.window {
+		entry.suppressed++
+		entry.last = message
+		d.mu.Unlock()
+		return nil
+	}
+	d.entries[key] = &dedupeEntry{first: now, last: message}
+	d.mu.Unlock()
+
+	if found && entry.suppressed > 0 {
+		if err := d.next.Send(ctx, d.summary(entry)); err != nil {
+			log.Error(err)
+		}
+	}
+	return d.next.Send(ctx, message)
+}
+
+// Flush sends the summaries of the windows that are over, it is meant to be run periodically
+func (d *NotificationDeduper) Flush(ctx Ctx) error {
+	now := dates.Now()
+	var summaries []Notification
+	d.mu.Lock()
+	for key, entry := range d.entries {
+		if now.Sub(entry.first) < d.window {
+			continue
+		}
+		if entry.suppressed > 0 {
+			summaries = append(summaries, d.summary(entry))
+		}
+		delete(d.entries, key)
+	}
+	d.mu.Unlock()
+
+	// the flush runs for every tenant at once, the summaries are sent in the context of their tenant
+	var errs []error
+	for _, summary := range summaries {
+		errs = append(errs, d.next.Send(NewCtx(ctx.Env, summary.TenantId), summary))
+	}
+	return errors.Join(errs...)
+}
+
+func (d *NotificationDeduper) summary(entry *dedupeEntry) Notification {
+	summary := entry.last
+	title := summary.Title
+	if title == "" {
+		title = summary.Message
+	}
+	summary.Title = fmt.Sprintf("Repeated %d times: %s", entry.suppressed, title)
+	summary.Message = fmt.Sprintf(
+		"%d similar notifications were suppressed since %s, the last one was:\n%s",
+		entry.suppressed, entry.first.Format(time.RFC3339), entry.last.Message,
+	)
+	return summary
+}
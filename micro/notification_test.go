@@ -0,0 +1,74 @@
+package micro
+
+import (
+	"github.com/qoalis/go-micro/util/dates"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingNotifier struct {
+	mu      sync.Mutex
+	sent    []Notification
+	tenants []string
+}
+
+func (r *recordingNotifier) Send(ctx Ctx, message Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, message)
+	r.tenants = append(r.tenants, ctx.TenantId)
+	return nil
+}
+
+func TestNotificationChannelAccepts(t *testing.T) {
+	channel := NotificationChannel{MinSeverity: SeverityWarning, Topics: []string{"billing.*", "auth"}}
+	assert.True(t, channel.Accepts(Notification{Severity: SeverityError, Topic: "billing.invoices"}))
+	assert.True(t, channel.Accepts(Notification{Severity: SeverityWarning, Topic: "auth"}))
+	assert.False(t, channel.Accepts(Notification{Severity: SeverityInfo, Topic: "auth"}))
+	assert.False(t, channel.Accepts(Notification{Severity: SeverityCritical, Topic: "infra"}))
+	assert.True(t, NotificationChannel{}.Accepts(Notification{Message: "plain"}))
+}
+
+func TestNotificationDeduper(t *testing.T) {
+	clock := dates.NewFakeClock()
+	dates.SetClock(clock)
+	defer dates.SetClock(nil)
+
+	recorder := &recordingNotifier{}
+	deduper := NewNotificationDeduper(recorder, 5*time.Minute)
+	ctx := NewCtx(nil, DefaultTenantId)
+	alert := Notification{Title: "sync failed", Message: "timeout", Severity: SeverityError, Topic: "jobs"}
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, deduper.Send(ctx, alert))
+		clock.Advance(time.Second)
+	}
+	assert.Nil(t, deduper.Send(ctx, Notification{Message: "another alert"}))
+	assert.Len(t, recorder.sent, 2)
+
+	// the summary is only sent once the window is over
+	assert.Nil(t, deduper.Flush(ctx))
+	assert.Len(t, recorder.sent, 2)
+	clock.Advance(5 * time.Minute)
+	assert.Nil(t, deduper.Flush(ctx))
+	assert.Len(t, recorder.sent, 3)
+	summary := recorder.sent[2]
+	assert.Equal(t, "Repeated 9 times: sync failed", summary.Title)
+	assert.Equal(t, SeverityError, summary.Severity)
+	assert.Equal(t, DefaultTenantId, summary.TenantId)
+
+	assert.Nil(t, deduper.Send(ctx, alert))
+	assert.Len(t, recorder.sent, 4)
+
+	// the summaries of the other tenants are sent in their context
+	acme := NewCtx(nil, "acme")
+	assert.Nil(t, deduper.Send(acme, alert))
+	assert.Nil(t, deduper.Send(acme, alert))
+	clock.Advance(5 * time.Minute)
+	assert.Nil(t, deduper.Flush(ctx))
+	assert.Len(t, recorder.sent, 6)
+	assert.Equal(t, "acme", recorder.sent[5].TenantId)
+	assert.Equal(t, "acme", recorder.tenants[5])
+}
@@ -1,4 +1,12 @@
 package micro
 
+// DiscoveryServicePrefix is the redis key holding the url (host:port) of the last started instance
+// of a service, e.g. discovery_service_orders
 const DiscoveryServicePrefix = "discovery_service_"
+
+// DiscoveryServicesChannel receives "name:url" when an instance of a service starts
 const DiscoveryServicesChannel = "discovery_services"
+
+// DiscoveryInstancesChannel receives the name of a service when its instances in the
+// ServiceRegistry change
+const DiscoveryInstancesChannel = "discovery_instances"
@@ -0,0 +1,292 @@
+package micro
+
+import (
+	"context"
+	"github.com/qoalis/go-micro/util/dates"
+	"github.com/qoalis/go-micro/util/ids"
+	log "github.com/sirupsen/logrus"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultServiceTTL is how long an instance is listed without heartbeat
+	DefaultServiceTTL = 15 * time.Second
+	// DefaultWatchInterval is how often a watched service is checked for expired instances
+	DefaultWatchInterval = time.Second
+)
+
+// ServiceInstance is a running instance of a service
+type ServiceInstance struct {
+	Id           string            `json:"id"`
+	Service      string            `json:"service"`
+	Url          string            `json:"url"`
+	Version      string            `json:"version,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	RegisteredAt time.Time         `json:"registeredAt"`
+	ExpiresAt    time.Time         `json:"expiresAt"`
+}
+
+// ServiceRegistry keeps the live instances of the services. Instances expire unless they are
+// registered again before their ttl, see Announce which sends the heartbeats.
+type ServiceRegistry interface {
+	// Register adds or refreshes the instance for ttl
+	Register(ctx context.Context, instance ServiceInstance, ttl time.Duration) error
+	Deregister(ctx context.Context, service string, id string) error
+	// Lookup returns the live instances of the service, sorted by id
+	Lookup(ctx context.Context, service string) ([]ServiceInstance, error)
+	// Watch sends the live instances of the service every time they change, starting with the
+	// current ones, until ctx is done
+	Watch(ctx context.Context, service string) (<-chan []ServiceInstance, error)
+}
+
+// ServiceHeartbeat keeps an instance registered until it is stopped
+type ServiceHeartbeat struct {
+	registry ServiceRegistry
+	instance ServiceInstance
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// Announce registers the instance and refreshes it every third of the ttl
+func Announce(ctx context.Context, registry ServiceRegistry, instance ServiceInstance, ttl time.Duration) (*ServiceHeartbeat, error) {
+	if ttl <= 0 {
+		ttl = DefaultServiceTTL
+	}
+	if err := registry.Register(ctx, instance, ttl); err != nil {
+		return nil, err
+	}
+	loop, cancel := context.WithCancel(context.Background())
+	hb := &ServiceHeartbeat{registry: registry, instance: instance, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(hb.done)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-loop.Done():
+				return
+			case <-ticker.C:
+				if err := registry.Register(loop, instance, ttl); err != nil {
+					log.Warnf("service heartbeat failed for %s -- %v", instance.Service, err)
+				}
+			}
+		}
+	}()
+	return hb, nil
+}
+
+// Stop ends the heartbeats and deregisters the instance
+func (hb *ServiceHeartbeat) Stop(ctx context.Context) error {
+	hb.cancel()
+	<-hb.done
+	return hb.registry.Deregister(ctx, hb.instance.Service, hb.instance.Id)
+}
+
+// WatchRegistry implements Watch on top of Lookup for the registries: the instances are looked up
+// every interval and every time changed is signaled, they are sent when they differ from the last
+// ones sent
+func WatchRegistry(ctx context.Context, lookup func(ctx context.Context) ([]ServiceInstance, error), changed <-chan struct{}, interval time.Duration) <-chan []ServiceInstance {
+	out := make(chan []ServiceInstance, 1)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var last []ServiceInstance
+		first := true
+		for {
+			instances, err := lookup(ctx)
+			if err != nil {
+				log.Warnf("service registry lookup failed -- %v", err)
+			} else if first || !sameInstances(last, instances) {
+				select {
+				case out <- instances:
+				case <-ctx.Done():
+					return
+				}
+				last, first = instances, false
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-changed:
+			}
+		}
+	}()
+	return out
+}
+
+// sameInstances compares the instances ignoring the heartbeats
+func sameInstances(a []ServiceInstance, b []ServiceInstance) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Id != b[i].Id || a[i].Url != b[i].Url || a[i].Version != b[i].Version ||
+			!reflect.DeepEqual(a[i].Metadata, b[i].Metadata) {
+			return false
+		}
+	}
+	return true
+}
+
+// SortInstances sorts the instances by id, the order of Lookup
+func SortInstances(instances []ServiceInstance) {
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Id < instances[j].Id })
+}
+
+// =================================================================================
+// MEMORY REGISTRY
+// =================================================================================
+
+// MemoryRegistry is a ServiceRegistry for a single process and the tests, expiration follows
+// dates.Now so that it can be driven by a fake clock
+type MemoryRegistry struct {
+	mu       sync.Mutex
+	services map[string]map[string]ServiceInstance
+	watchers map[string][]chan struct{}
+	// Interval is how often the watchers look for expired instances
+	Interval time.Duration
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		services: map[string]map[string]ServiceInstance{},
+		watchers: map[string][]chan struct{}{},
+		Interval: DefaultWatchInterval,
+	}
+}
+
+func (r *MemoryRegistry) Register(_ context.Context, instance ServiceInstance, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = DefaultServiceTTL
+	}
+	now := dates.Now()
+	r.mu.Lock()
+	instances, ok := r.services[instance.Service]
+	if !ok {
+		instances = map[string]ServiceInstance{}
+		r.services[instance.Service] = instances
+	}
+	existing, found := instances[instance.Id]
+	live := found && existing.ExpiresAt.After(now)
+	if live {
+		instance.RegisteredAt = existing.RegisteredAt
+	} else {
+		instance.RegisteredAt = now
+	}
+	instance.ExpiresAt = now.Add(ttl)
+	instances[instance.Id] = instance
+	r.mu.Unlock()
+	if !live || !sameInstances([]ServiceInstance{existing}, []ServiceInstance{instance}) {
+		r.notify(instance.Service)
+	}
+	return nil
+}
+
+func (r *MemoryRegistry) Deregister(_ context.Context, service string, id string) error {
+	r.mu.Lock()
+	_, found := r.services[service][id]
+	delete(r.services[service], id)
+	r.mu.Unlock()
+	if found {
+		r.notify(service)
+	}
+	return nil
+}
+
+func (r *MemoryRegistry) Lookup(_ context.Context, service string) ([]ServiceInstance, error) {
+	now := dates.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	instances := make([]ServiceInstance, 0, len(r.services[service]))
+	for id, instance := range r.services[service] {
+		if !instance.ExpiresAt.After(now) {
+			delete(r.services[service], id)
+			continue
+		}
+		instances = append(instances, instance)
+	}
+	SortInstances(instances)
+	return instances, nil
+}
+
+func (r *MemoryRegistry) Watch(ctx context.Context, service string) (<-chan []ServiceInstance, error) {
+	changed := make(chan struct{}, 1)
+	r.mu.Lock()
+	r.watchers[service] = append(r.watchers[service], changed)
+	r.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		watchers := r.watchers[service]
+		for i, w := range watchers {
+			if w == changed {
+				r.watchers[service] = append(watchers[:i], watchers[i+1:]...)
+				break
+			}
+		}
+	}()
+	return WatchRegistry(ctx, func(ctx context.Context) ([]ServiceInstance, error) {
+		return r.Lookup(ctx, service)
+	}, changed, r.Interval), nil
+}
+
+func (r *MemoryRegistry) notify(service string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, w := range r.watchers[service] {
+		select {
+		case w <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// =================================================================================
+// APP REGISTRATION
+// =================================================================================
+
+// Announce registers the app under its name in Env.Registry with heartbeats until the shutdown, the
+// instance url is DiscoveryServiceUrl, with http:// when it has no scheme. It does nothing when
+// discovery is disabled
+func (app *App) Announce(ctx context.Context) error {
+	env := app.Env
+	if env.Registry == nil || env.DiscoveryServiceUrl == "" || app.registration != nil {
+		return nil
+	}
+	name := app.Name
+	url := env.DiscoveryServiceUrl
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+	instance := ServiceInstance{
+		Id:       ids.NewId(""),
+		Service:  name,
+		Url:      url,
+		Version:  app.Version,
+		Metadata: app.Metadata,
+	}
+	registration, err := Announce(ctx, env.Registry, instance, DefaultServiceTTL)
+	if err != nil {
+		return err
+	}
+	app.registration = registration
+	log.Infof("service registered: %s -> %s (%s)", name, instance.Url, instance.Id)
+	return nil
+}
+
+// deregister removes the app from the registry, it is the first step of the shutdown
+func (app *App) deregister(ctx context.Context) error {
+	if app.registration == nil {
+		return nil
+	}
+	registration := app.registration
+	app.registration = nil
+	return registration.Stop(ctx)
+}
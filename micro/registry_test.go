@@ -0,0 +1,112 @@
+package micro
+
+import (
+	"context"
+	"github.com/qoalis/go-micro/util/dates"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func instanceIds(instances []ServiceInstance) []string {
+	result := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		result = append(result, instance.Id)
+	}
+	return result
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	clock := dates.NewFakeClock()
+	dates.SetClock(clock)
+	t.Cleanup(func() { dates.SetClock(nil) })
+	ctx := context.Background()
+	registry := NewMemoryRegistry()
+
+	assert.Nil(t, registry.Register(ctx, ServiceInstance{Id: "b", Service: "orders", Url: "http://b:8080"}, 10*time.Second))
+	assert.Nil(t, registry.Register(ctx, ServiceInstance{Id: "a", Service: "orders", Url: "http://a:8080", Version: "1.2.0",
+		Metadata: map[string]string{"zone": "eu"}}, 10*time.Second))
+	assert.Nil(t, registry.Register(ctx, ServiceInstance{Id: "c", Service: "billing", Url: "http://c:8080"}, 10*time.Second))
+
+	instances, err := registry.Lookup(ctx, "orders")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, instanceIds(instances))
+	assert.Equal(t, "1.2.0", instances[0].Version)
+	assert.Equal(t, "eu", instances[0].Metadata["zone"])
+	assert.Equal(t, clock.Now().Add(10*time.Second), instances[0].ExpiresAt)
+
+	// a heartbeat keeps the instance, the other one expires
+	clock.Advance(6 * time.Second)
+	assert.Nil(t, registry.Register(ctx, ServiceInstance{Id: "a", Service: "orders", Url: "http://a:8080"}, 10*time.Second))
+	clock.Advance(6 * time.Second)
+	instances, _ = registry.Lookup(ctx, "orders")
+	assert.Equal(t, []string{"a"}, instanceIds(instances))
+	assert.Equal(t, clock.Now().Add(-12*time.Second), instances[0].RegisteredAt)
+
+	assert.Nil(t, registry.Deregister(ctx, "orders", "a"))
+	instances, _ = registry.Lookup(ctx, "orders")
+	assert.Empty(t, instances)
+	instances, _ = registry.Lookup(ctx, "unknown")
+	assert.Empty(t, instances)
+}
+
+func TestMemoryRegistryWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry := NewMemoryRegistry()
+	registry.Interval = 10 * time.Millisecond
+	assert.Nil(t, registry.Register(ctx, ServiceInstance{Id: "a", Service: "orders"}, time.Minute))
+
+	updates, err := registry.Watch(ctx, "orders")
+	assert.Nil(t, err)
+	next := func() []string {
+		select {
+		case instances := <-updates:
+			return instanceIds(instances)
+		case <-time.After(time.Second):
+			t.Fatal("no update")
+			return nil
+		}
+	}
+	assert.Equal(t, []string{"a"}, next())
+
+	// heartbeats of the known instances are not changes
+	assert.Nil(t, registry.Register(ctx, ServiceInstance{Id: "a", Service: "orders"}, time.Minute))
+	assert.Nil(t, registry.Register(ctx, ServiceInstance{Id: "x", Service: "billing"}, time.Minute))
+	assert.Nil(t, registry.Register(ctx, ServiceInstance{Id: "b", Service: "orders"}, time.Minute))
+	assert.Equal(t, []string{"a", "b"}, next())
+
+	assert.Nil(t, registry.Deregister(ctx, "orders", "a"))
+	assert.Equal(t, []string{"b"}, next())
+
+	// expirations are noticed by polling
+	assert.Nil(t, registry.Register(ctx, ServiceInstance{Id: "b", Service: "orders"}, 30*time.Millisecond))
+	assert.Equal(t, []string{}, next())
+
+	cancel()
+	select {
+	case _, ok := <-updates:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("watch not closed")
+	}
+}
+
+func TestAppAnnounce(t *testing.T) {
+	t.Cleanup(Reset)
+	registry := NewMemoryRegistry()
+	env := &Env{Registry: registry, DiscoverySericeName: DiscoveryServicePrefix + "orders", DiscoveryServiceUrl: "orders:8080"}
+	app := &App{Name: "orders", Version: "2.0.0", Env: env, Metadata: map[string]string{"zone": "eu"}}
+	ctx := context.Background()
+
+	assert.Nil(t, app.Announce(ctx))
+	instances, _ := registry.Lookup(ctx, "orders")
+	assert.Len(t, instances, 1)
+	assert.Equal(t, "http://orders:8080", instances[0].Url)
+	assert.Equal(t, "2.0.0", instances[0].Version)
+	assert.Equal(t, "eu", instances[0].Metadata["zone"])
+
+	assert.Nil(t, app.Shutdown())
+	instances, _ = registry.Lookup(ctx, "orders")
+	assert.Empty(t, instances)
+}
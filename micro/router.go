@@ -1,10 +1,10 @@
 package micro
 
 import (
-	log "github.com/sirupsen/logrus"
+	"context"
+	"errors"
 	"github.com/swaggo/swag"
 	"net/http"
-	"strings"
 )
 
 // AuthKey is used in adapters
@@ -14,17 +14,28 @@ const AuthKey = "user"
 const TenantId = "tenant"
 const EnvKey = "env"
 const DisableImplicitTransaction = "implicit_transaction_disabled"
+const AfterHandlersKey = "after_handlers"
+
+// ErrResponseCommitted is returned by a middleware that wrote the response itself, it stops the chain
+var ErrResponseCommitted = errors.New("response_committed")
 
 type Router interface {
 	BaseRouter
 	Handler() http.Handler
 	Start(addr string) error
-	Shutdown() error
+	// Shutdown stops accepting connections and waits for the in-flight requests until ctx is done
+	Shutdown(ctx context.Context) error
 	Group(path string, filters ...MiddlewareFunc) BaseRouter
 	Use(filter MiddlewareFunc)
 	Proxy(path string, upstreams *RouterUpstream, filters ...MiddlewareFunc)
 }
 
+// HandlerChecker is implemented by the routers able to tell, once the components are provided,
+// whether the parameters of their handlers can be resolved. App.Start runs the check.
+type HandlerChecker interface {
+	CheckHandlers() error
+}
+
 type BaseRouter interface {
 	POST(path string, handler any, filters ...MiddlewareFunc)
 	PUT(path string, handler any, filters ...MiddlewareFunc)
@@ -54,6 +65,12 @@ type RouterConfig struct {
 	DisableJwtFilter bool
 	SentryDsn        string
 	OnShutdown       func()
+	// ProxyTransport sends the proxied requests, it defaults to a pooled http.Transport
+	ProxyTransport http.RoundTripper
+	// TrustedProxies are the IPs or CIDRs of the load balancers in front of the router. The proxies
+	// keep the X-Forwarded-For chain they send and replace it otherwise, so that clients cannot
+	// spoof their address.
+	TrustedProxies []string
 }
 
 type MiddlewareFunc func(ctx Ctx) error
@@ -73,41 +90,3 @@ type ErrorResponse struct {
 	Error   string `json:"error,omitempty"`
 	Details any    `json:"details,omitempty"`
 }
-
-type RouterUpstream struct {
-	data map[string]*Upstream
-}
-
-type Upstream struct {
-	Id     string
-	Uri    string
-	Prefix string
-	Strip  bool
-}
-
-func NewRouterUpstream(data map[string]*Upstream) *RouterUpstream {
-	for id, up := range data {
-		up.Id = id
-	}
-	return &RouterUpstream{
-		data: data,
-	}
-}
-
-func (u *RouterUpstream) SetUri(id string, value string) {
-	u.data[id].Uri = value
-	log.Infof("upstream updated: %s --> %s", id, value)
-}
-
-func (u *RouterUpstream) Lookup(path string) *Upstream {
-	for _, up := range u.data {
-		if strings.HasPrefix(path, up.Prefix) {
-			return up
-		}
-	}
-	return nil
-}
-
-func (u *RouterUpstream) All() map[string]*Upstream {
-	return u.data
-}
@@ -3,12 +3,14 @@ package micro
 import (
 	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"github.com/qoalis/go-micro/di"
 	"github.com/qoalis/go-micro/util/h"
 	log "github.com/sirupsen/logrus"
 	"github.com/swaggo/swag"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -31,6 +33,15 @@ type Cfg struct {
 	CorsDisabled               bool
 	DisableImplicitTransaction bool
 	SwaggerSpec                *swag.Spec
+	// TrustedProxies are added to the TRUSTED_PROXIES env variable (comma separated), see
+	// RouterConfig.TrustedProxies
+	TrustedProxies []string
+	// ShutdownTimeout and DrainDelay are copied to the App, see App.Shutdown
+	ShutdownTimeout time.Duration
+	DrainDelay      time.Duration
+	// Config is a pointer to the application config struct, it is bound at startup (see LoadConfig)
+	// and is available with Config[T] or as a component of the container
+	Config any
 }
 
 // ----------------------------------------------
@@ -57,6 +68,15 @@ func (app *App) Init(features []Feature) *App {
 	env := app.Env
 	globalLocalizer = env.Localizer
 
+	if app.Container == nil {
+		app.Container = env.Container
+	}
+	if app.Container == nil {
+		app.Container = di.New()
+	}
+	env.Container = app.Container
+	provideDefaults(app)
+
 	if env.Scheduler != nil {
 		di.Register(SchedulerService, env.Scheduler)
 	}
@@ -70,6 +90,9 @@ func (app *App) Init(features []Feature) *App {
 	if env.Notifier != nil {
 		di.Register(Notifications, env.Notifier)
 		_ = Subscribe(NotificationTopic, func(ctx Ctx, payload Event) error {
+			if notification, ok := payload.Data.(Notification); ok {
+				return env.Notifier.Send(ctx, notification)
+			}
 			return env.Notifier.Send(ctx, Notification{
 				Message: payload.Event,
 			})
@@ -116,6 +139,7 @@ func configureFeature(app *App, feat Feature, bootstrap h.Map) {
 	if feat.Configure != nil {
 		feat.Configure(app)
 	}
+	registerFeature(app, feat)
 
 	bootstrap[feat.Name] = true
 }
@@ -138,21 +162,18 @@ func (app *App) Run(addr ...string) {
 		port = addr[0]
 	}
 
-	// start the server
-	go func() {
-		_ = app.Router.Start("0.0.0.0:" + port)
-	}()
+	// start the components and features before accepting requests
+	if err := app.Start(context.Background()); err != nil {
+		log.Errorf("unable to start the app -- %v", err)
+		exitCode = 1
+		return
+	}
 
-	// run the cleanup after the server is terminated
-	defer func() {
-		_ = app.Router.Shutdown()
-		if app.Env.DataSources != nil {
-			app.Env.Close()
-		}
-		if app.ShutdownListeners != nil {
-			for _, listener := range app.ShutdownListeners {
-				listener()
-			}
+	// start the server, a server failing to start (e.g. port in use) stops the app
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := app.Router.Start("0.0.0.0:" + port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
 		}
 	}()
 
@@ -176,21 +197,25 @@ func (app *App) Run(addr ...string) {
 			log.Infof("discovery service url broadcasted: %s -> %s", app.Name, app.Env.DiscoveryServiceUrl)
 		}()
 	}
-	/*if err != nil {
-		fmt.Printf("error: %v", err)
-		exitCode = 1
-		return
-	}*/
-
-	// ensure the server is shutdown gracefully & app runs
-	gracefully()
-}
+	if err := app.Announce(context.Background()); err != nil {
+		log.Errorf("unable to register the service -- %v", err)
+	}
 
-func gracefully() {
+	// wait for a termination signal or a server failure then shutdown gracefully
 	quit := make(chan os.Signal, 1)
-	defer close(quit)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	defer signal.Stop(quit)
+	select {
+	case sig := <-quit:
+		log.Infof("%s received, shutting down", sig)
+	case err := <-serverErr:
+		log.Errorf("unable to start the server -- %v", err)
+		exitCode = 1
+	}
+	if err := app.Shutdown(); err != nil {
+		log.Errorf("shutdown failed -- %v", err)
+		exitCode = 1
+	}
 }
 
 func T(messageId string, other ...string) string {
@@ -1,5 +1,10 @@
 package micro
 
+import (
+	"context"
+	"github.com/qoalis/go-micro/util/dates"
+)
+
 type SchedulerHandler = func(ctx Ctx) error
 
 type Scheduler interface {
@@ -9,4 +14,12 @@ type Scheduler interface {
 	Once(handler SchedulerHandler)
 	EveryTenant(interval string, handler SchedulerHandler)
 	OncePerTenant(handler SchedulerHandler)
+	// Stop prevents new runs and waits for the running jobs until the context is done
+	Stop(ctx context.Context) error
+}
+
+// ClockAware is implemented by the schedulers which let a dates.FakeClock drive their jobs, see
+// Env.UseClock
+type ClockAware interface {
+	UseClock(clock dates.Clock)
 }
@@ -0,0 +1,89 @@
+package micro
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+type shutdownLog struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (l *shutdownLog) add(step string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.steps = append(l.steps, step)
+}
+
+type shutdownRouter struct {
+	Router
+	log    *shutdownLog
+	health *HealthProbe
+}
+
+func (r *shutdownRouter) Shutdown(ctx context.Context) error {
+	r.log.add("router:" + r.health.Ready(ctx).Status)
+	return nil
+}
+
+type shutdownScheduler struct {
+	Scheduler
+	log *shutdownLog
+}
+
+func (s *shutdownScheduler) Stop(ctx context.Context) error {
+	s.log.add("scheduler")
+	return nil
+}
+
+type shutdownDataSource struct {
+	DataSource
+	log *shutdownLog
+}
+
+func (d *shutdownDataSource) Ping() error {
+	return nil
+}
+
+func (d *shutdownDataSource) Close() {
+	d.log.add("db")
+}
+
+func TestAppShutdown(t *testing.T) {
+	t.Cleanup(Reset)
+	steps := &shutdownLog{}
+	env := &Env{
+		Scheduler:   &shutdownScheduler{log: steps},
+		DataSources: map[string]DataSource{DefaultTenantId: &shutdownDataSource{log: steps}},
+	}
+	env.Health = NewHealthProbe(env, HealthConfig{})
+	app := &App{Env: env, Router: &shutdownRouter{log: steps, health: env.Health}, DrainDelay: 10 * time.Millisecond}
+	app.Init([]Feature{{
+		Name: "worker",
+		OnStop: func(ctx context.Context) error {
+			steps.add("worker")
+			return nil
+		},
+	}})
+	assert.Equal(t, "UP", env.Health.Ready(context.Background()).Status)
+	assert.Nil(t, app.Start(context.Background()))
+
+	assert.Nil(t, SubscribeAsync("slow", func(ctx Ctx, payload Event) error {
+		time.Sleep(20 * time.Millisecond)
+		steps.add("event")
+		return nil
+	}))
+	Publish(Ctx{}, "slow", Event{})
+
+	assert.Nil(t, app.Shutdown())
+	assert.Equal(t, []string{"router:DOWN", "scheduler", "event", "worker", "db"}, steps.steps)
+
+	// the bus is closed once drained
+	Publish(Ctx{}, "slow", Event{})
+	WaitAsync()
+	assert.Len(t, steps.steps, 5)
+}
@@ -0,0 +1,173 @@
+package micro
+
+import (
+	goerrors "errors"
+	"github.com/qoalis/go-micro/util/dates"
+	"github.com/qoalis/go-micro/util/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type TypedCacheConfig struct {
+	// TTL is how long a loaded value is considered fresh
+	TTL time.Duration
+	// StaleTTL is how long a value is still served after TTL while it is refreshed in the background
+	StaleTTL time.Duration
+	// NegativeTTL caches not found results for that long, 0 disables negative caching
+	NegativeTTL time.Duration
+}
+
+type CacheStats struct {
+	Hits         uint64 `json:"hits"`
+	StaleHits    uint64 `json:"stale_hits"`
+	NegativeHits uint64 `json:"negative_hits"`
+	Misses       uint64 `json:"misses"`
+	Loads        uint64 `json:"loads"`
+	LoadErrors   uint64 `json:"load_errors"`
+}
+
+type typedCacheEntry[T any] struct {
+	Value      T         `json:"value"`
+	NotFound   string    `json:"not_found,omitempty"`
+	FreshUntil time.Time `json:"fresh_until"`
+}
+
+// TypedCache is a read-through cache of T. Concurrent misses on the same key share a single load.
+type TypedCache[T any] struct {
+	cache Cache
+	name  string
+	cfg   TypedCacheConfig
+	group singleflight.Group
+	// keys being refreshed in the background
+	refreshing sync.Map
+	hits       atomic.Uint64
+	stale      atomic.Uint64
+	neg        atomic.Uint64
+	misses     atomic.Uint64
+	loads      atomic.Uint64
+	errs       atomic.Uint64
+}
+
+func NewTypedCache[T any](cache Cache, name string, cfg TypedCacheConfig) *TypedCache[T] {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultCacheTTL
+	}
+	return &TypedCache[T]{cache: cache, name: name, cfg: cfg}
+}
+
+func (c *TypedCache[T]) key(key string) string {
+	return c.name + ":" + key
+}
+
+// Get returns the cached value or calls load. A cached not found result is returned as a ResourceNotFoundError.
+func (c *TypedCache[T]) Get(ctx Ctx, key string, load func(ctx Ctx) (T, error)) (T, error) {
+	var entry typedCacheEntry[T]
+	found, err := c.cache.Get(ctx, c.key(key), &entry)
+	if err != nil {
+		log.Warnf("cache %s: unable to read %s: %s", c.name, key, err)
+	}
+	if found && err == nil {
+		if entry.NotFound != "" {
+			c.neg.Add(1)
+			var zero T
+			return zero, errors.ResourceNotFound(entry.NotFound)
+		}
+		if dates.Now().Before(entry.FreshUntil) {
+			c.hits.Add(1)
+			return entry.Value, nil
+		}
+		// stale: serve it and refresh in the background
+		c.stale.Add(1)
+		c.refresh(ctx, key, load)
+		return entry.Value, nil
+	}
+	c.misses.Add(1)
+	return c.load(ctx, key, load)
+}
+
+func (c *TypedCache[T]) refresh(ctx Ctx, key string, load func(ctx Ctx) (T, error)) {
+	flightKey := CacheKey(ctx, c.key(key))
+	if _, running := c.refreshing.LoadOrStore(flightKey, true); running {
+		return
+	}
+	// the request ctx (and its transaction) may be gone when the refresh runs
+	detached := NewCtx(ctx.Env, ctx.TenantId)
+	detached.Auth = ctx.Auth
+	go func() {
+		defer c.refreshing.Delete(flightKey)
+		_, _ = c.load(detached, key, load)
+	}()
+}
+
+func (c *TypedCache[T]) load(ctx Ctx, key string, load func(ctx Ctx) (T, error)) (T, error) {
+	value, err, _ := c.group.Do(CacheKey(ctx, c.key(key)), func() (interface{}, error) {
+		c.loads.Add(1)
+		value, err := load(ctx)
+		if err != nil {
+			c.errs.Add(1)
+			if c.cfg.NegativeTTL > 0 && isNotFound(err) {
+				c.store(ctx, key, typedCacheEntry[T]{NotFound: notFoundMessage(err)}, c.cfg.NegativeTTL)
+			}
+			return value, err
+		}
+		c.store(ctx, key, typedCacheEntry[T]{Value: value, FreshUntil: dates.NowPlus(c.cfg.TTL)}, c.cfg.TTL+c.cfg.StaleTTL)
+		return value, nil
+	})
+	if value == nil {
+		var zero T
+		return zero, err
+	}
+	return value.(T), err
+}
+
+func (c *TypedCache[T]) store(ctx Ctx, key string, entry typedCacheEntry[T], ttl time.Duration) {
+	if err := c.cache.Set(ctx, c.key(key), entry, ttl); err != nil {
+		log.Warnf("cache %s: unable to store %s: %s", c.name, key, err)
+	}
+}
+
+func (c *TypedCache[T]) Set(ctx Ctx, key string, value T) error {
+	return c.cache.Set(ctx, c.key(key), typedCacheEntry[T]{Value: value, FreshUntil: dates.NowPlus(c.cfg.TTL)}, c.cfg.TTL+c.cfg.StaleTTL)
+}
+
+func (c *TypedCache[T]) Invalidate(ctx Ctx, keys ...string) error {
+	namespaced := make([]string, 0, len(keys))
+	for _, key := range keys {
+		namespaced = append(namespaced, c.key(key))
+	}
+	return c.cache.Delete(ctx, namespaced...)
+}
+
+func (c *TypedCache[T]) InvalidateAll(ctx Ctx) error {
+	return c.cache.DeleteByPrefix(ctx, c.name+":")
+}
+
+func (c *TypedCache[T]) Stats() CacheStats {
+	return CacheStats{
+		Hits:         c.hits.Load(),
+		StaleHits:    c.stale.Load(),
+		NegativeHits: c.neg.Load(),
+		Misses:       c.misses.Load(),
+		Loads:        c.loads.Load(),
+		LoadErrors:   c.errs.Load(),
+	}
+}
+
+func isNotFound(err error) bool {
+	var notFound *errors.ResourceNotFoundError
+	return err == ErrRecordNotFound || goerrors.As(err, &notFound)
+}
+
+func notFoundMessage(err error) string {
+	var notFound *errors.ResourceNotFoundError
+	if goerrors.As(err, &notFound) && notFound.Message != "" {
+		return notFound.Message
+	}
+	if functional, ok := err.(*errors.FunctionalError); ok && functional.Message != "" {
+		return functional.Message
+	}
+	return "not_found"
+}
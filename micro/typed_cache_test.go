@@ -0,0 +1,88 @@
+package micro
+
+import (
+	"github.com/qoalis/go-micro/util/dates"
+	"github.com/qoalis/go-micro/util/errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type cachedUser struct {
+	Id   string
+	Name string
+}
+
+func TestTypedCacheDeduplicatesLoads(t *testing.T) {
+	users := NewTypedCache[cachedUser](NewCache(time.Minute), "users", TypedCacheConfig{TTL: time.Minute})
+	ctx := NewCtx(nil, "acme")
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	load := func(ctx Ctx) (cachedUser, error) {
+		calls.Add(1)
+		<-release
+		return cachedUser{Id: "1", Name: "alice"}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := users.Get(ctx, "1", load)
+			assert.Nil(t, err)
+			assert.Equal(t, "alice", user.Name)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	_, _ = users.Get(ctx, "1", load)
+	assert.Equal(t, uint64(1), users.Stats().Hits)
+}
+
+func TestTypedCacheStaleAndNegative(t *testing.T) {
+	clock := dates.NewFakeClock()
+	dates.SetClock(clock)
+	defer dates.SetClock(nil)
+
+	users := NewTypedCache[cachedUser](NewCache(time.Hour), "users", TypedCacheConfig{
+		TTL:         time.Minute,
+		StaleTTL:    time.Hour,
+		NegativeTTL: time.Minute,
+	})
+	ctx := NewCtx(nil, "acme")
+
+	version := atomic.Int32{}
+	load := func(ctx Ctx) (cachedUser, error) {
+		return cachedUser{Id: "1", Name: string(rune('a' + version.Add(1) - 1))}, nil
+	}
+	user, _ := users.Get(ctx, "1", load)
+	assert.Equal(t, "a", user.Name)
+
+	// stale value is served while a refresh runs in the background
+	clock.Advance(2 * time.Minute)
+	user, _ = users.Get(ctx, "1", load)
+	assert.Equal(t, "a", user.Name)
+	assert.Eventually(t, func() bool {
+		user, _ = users.Get(ctx, "1", load)
+		return user.Name == "b"
+	}, time.Second, 10*time.Millisecond)
+
+	missing := 0
+	notFound := func(ctx Ctx) (cachedUser, error) {
+		missing++
+		return cachedUser{}, errors.ResourceNotFound("user_not_found")
+	}
+	_, err := users.Get(ctx, "2", notFound)
+	assert.NotNil(t, err)
+	_, err = users.Get(ctx, "2", notFound)
+	assert.IsType(t, &errors.ResourceNotFoundError{}, err)
+	assert.Equal(t, 1, missing)
+	assert.Equal(t, uint64(1), users.Stats().NegativeHits)
+}
@@ -0,0 +1,423 @@
+package micro
+
+import (
+	"context"
+	"fmt"
+	"github.com/qoalis/go-micro/util/dates"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultProxyTimeout is the time given to an upstream to send the response headers
+const DefaultProxyTimeout = 30 * time.Second
+
+// Balancer picks the instance of an upstream serving a request
+type Balancer string
+
+const (
+	RoundRobin       Balancer = "round_robin"
+	LeastConnections Balancer = "least_connections"
+)
+
+type RouterUpstream struct {
+	mu   sync.RWMutex
+	data map[string]*Upstream
+	// ordered by decreasing prefix length then by decreasing number of rules, so that the most
+	// specific upstream matches first
+	ordered []*Upstream
+}
+
+type Upstream struct {
+	Id string
+	// Uri is the static address of the upstream, it is used when no instance is live
+	Uri    string
+	Prefix string
+	Strip  bool
+	// Hosts, Methods and Headers restrict the requests routed to the upstream. A host accepts a
+	// leading wildcard (*.example.com), a header with an empty value only needs to be present.
+	Hosts   []string
+	Methods []string
+	Headers map[string]string
+	// Rewrites are applied in order to the forwarded path, after Strip
+	Rewrites []PathRewrite
+	// Filters run before the request is proxied to the upstream
+	Filters []MiddlewareFunc
+	// Service is the name of the upstream in the service registry, defaults to Id
+	Service string
+	// Balancer defaults to RoundRobin
+	Balancer Balancer
+	// Timeout is the time given to an address to send the response headers, it does not bound
+	// streamed bodies. Defaults to DefaultProxyTimeout.
+	Timeout time.Duration
+	// Retries is the number of other addresses tried when an idempotent request without body fails
+	Retries int
+	// BreakerThreshold and BreakerCooldown configure the circuit breaker of every address
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	mu               sync.Mutex
+	rewrites         []*regexp.Regexp
+	instances        []*UpstreamInstance
+	static           *UpstreamInstance
+	next             uint64
+}
+
+// UpstreamInstance is an address of an upstream. The instances follow the registry (see Watch),
+// which drops them once their heartbeat expires.
+type UpstreamInstance struct {
+	Id      string
+	Url     string
+	active  atomic.Int64
+	breaker *CircuitBreaker
+}
+
+// Breaker is the circuit breaker of the instance
+func (i *UpstreamInstance) Breaker() *CircuitBreaker {
+	return i.breaker
+}
+
+// Active is the number of requests in flight on the instance
+func (i *UpstreamInstance) Active() int64 {
+	return i.active.Load()
+}
+
+// PathRewrite replaces the matches of the Pattern regexp in the forwarded path, the Replacement
+// accepts the $1 / ${name} references of regexp.ReplaceAllString
+type PathRewrite struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// NewRouterUpstream is like NewRouterUpstreamE but panics when a rewrite of an upstream is invalid
+func NewRouterUpstream(data map[string]*Upstream) *RouterUpstream {
+	upstreams, err := NewRouterUpstreamE(data)
+	if err != nil {
+		panic(err)
+	}
+	return upstreams
+}
+
+// NewRouterUpstreamE orders the upstreams by specificity and compiles their rewrites
+func NewRouterUpstreamE(data map[string]*Upstream) (*RouterUpstream, error) {
+	ordered := make([]*Upstream, 0, len(data))
+	for id, up := range data {
+		up.Id = id
+		up.rewrites = make([]*regexp.Regexp, 0, len(up.Rewrites))
+		for _, rewrite := range up.Rewrites {
+			re, err := regexp.Compile(rewrite.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rewrite of upstream %s -- %w", id, err)
+			}
+			up.rewrites = append(up.rewrites, re)
+		}
+		ordered = append(ordered, up)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if len(a.Prefix) != len(b.Prefix) {
+			return len(a.Prefix) > len(b.Prefix)
+		}
+		if a.rules() != b.rules() {
+			return a.rules() > b.rules()
+		}
+		return a.Id < b.Id
+	})
+	return &RouterUpstream{
+		data:    data,
+		ordered: ordered,
+	}, nil
+}
+
+func (u *RouterUpstream) SetUri(id string, value string) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	up := u.data[id]
+	up.mu.Lock()
+	up.Uri = value
+	up.static = nil
+	up.mu.Unlock()
+	log.Infof("upstream updated: %s --> %s", id, value)
+}
+
+// SetInstances replaces the instances of the upstream, the requests in flight of the instances
+// that are kept are still counted
+func (u *RouterUpstream) SetInstances(id string, instances []ServiceInstance) {
+	u.mu.RLock()
+	up, ok := u.data[id]
+	u.mu.RUnlock()
+	if !ok {
+		return
+	}
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	existing := make(map[string]*UpstreamInstance, len(up.instances))
+	for _, instance := range up.instances {
+		existing[instance.Id] = instance
+	}
+	updated := make([]*UpstreamInstance, 0, len(instances))
+	urls := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		target, found := existing[instance.Id]
+		if !found || target.Url != instance.Url {
+			target = up.newInstance(instance.Id, instance.Url)
+		}
+		updated = append(updated, target)
+		urls = append(urls, instance.Url)
+	}
+	up.instances = updated
+	log.Infof("upstream updated: %s --> [%s]", id, strings.Join(urls, ", "))
+}
+
+// Lookup returns the upstream with the longest prefix of the path, the upstreams with host, method
+// or header rules are skipped (see Match)
+func (u *RouterUpstream) Lookup(path string) *Upstream {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	for _, up := range u.ordered {
+		if strings.HasPrefix(path, up.Prefix) && up.rules() == 0 {
+			return up
+		}
+	}
+	return nil
+}
+
+// Match returns the upstream with the longest prefix of the request path whose rules accept the
+// request, the upstream with the most rules wins between equal prefixes
+func (u *RouterUpstream) Match(r *http.Request) *Upstream {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	for _, up := range u.ordered {
+		if strings.HasPrefix(r.URL.Path, up.Prefix) && up.accepts(r) {
+			return up
+		}
+	}
+	return nil
+}
+
+func (u *RouterUpstream) All() map[string]*Upstream {
+	return u.data
+}
+
+// Watch keeps the instances of the upstreams in sync with the registry until ctx is done
+func (u *RouterUpstream) Watch(ctx context.Context, registry ServiceRegistry) error {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	for id, up := range u.data {
+		service := up.Service
+		if service == "" {
+			service = id
+		}
+		updates, err := registry.Watch(ctx, service)
+		if err != nil {
+			return err
+		}
+		go func(id string) {
+			for instances := range updates {
+				u.SetInstances(id, instances)
+			}
+		}(id)
+	}
+	return nil
+}
+
+func (up *Upstream) rules() int {
+	rules := len(up.Headers)
+	if len(up.Hosts) > 0 {
+		rules++
+	}
+	if len(up.Methods) > 0 {
+		rules++
+	}
+	return rules
+}
+
+func (up *Upstream) accepts(r *http.Request) bool {
+	if len(up.Methods) > 0 && !containsFold(up.Methods, r.Method) {
+		return false
+	}
+	if len(up.Hosts) > 0 {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		if !matchesHost(up.Hosts, host) {
+			return false
+		}
+	}
+	for name, expected := range up.Headers {
+		values, ok := r.Header[http.CanonicalHeaderKey(name)]
+		if !ok || (expected != "" && !containsFold(values, expected)) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if strings.EqualFold(pattern, host) {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok && len(host) > len(suffix) &&
+			strings.HasSuffix(strings.ToLower(host), strings.ToLower(suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// RewritePath applies the Rewrites to the forwarded path
+func (up *Upstream) RewritePath(path string) string {
+	for i, re := range up.rewrites {
+		path = re.ReplaceAllString(path, up.Rewrites[i].Replacement)
+	}
+	return path
+}
+
+func (up *Upstream) newInstance(id string, url string) *UpstreamInstance {
+	return &UpstreamInstance{Id: id, Url: url, breaker: &CircuitBreaker{
+		Threshold: up.BreakerThreshold,
+		Cooldown:  up.BreakerCooldown,
+	}}
+}
+
+// Instances returns the instances of the upstream
+func (up *Upstream) Instances() []*UpstreamInstance {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	return append([]*UpstreamInstance{}, up.instances...)
+}
+
+// Acquire picks the address serving the next request with the balancer, among the instances whose
+// circuit is closed. The static Uri is used when the upstream has no instance. release
+// must be called with the outcome once the request is done, ok is false when no address is
+// available.
+func (up *Upstream) Acquire() (uri string, release func(outcome RequestOutcome), ok bool) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	now := dates.Now()
+	live := up.instances
+	if len(live) == 0 && up.Uri != "" {
+		if up.static == nil {
+			up.static = up.newInstance("", up.Uri)
+		}
+		live = []*UpstreamInstance{up.static}
+	}
+	available := make([]*UpstreamInstance, 0, len(live))
+	for _, instance := range live {
+		if instance.breaker.ready(now) {
+			available = append(available, instance)
+		}
+	}
+	if len(available) == 0 {
+		return "", func(RequestOutcome) {}, false
+	}
+	var picked *UpstreamInstance
+	switch up.Balancer {
+	case LeastConnections:
+		// ties are broken in turn so that idle instances share the load
+		start := int(up.next % uint64(len(available)))
+		for i := range available {
+			candidate := available[(start+i)%len(available)]
+			if picked == nil || candidate.Active() < picked.Active() {
+				picked = candidate
+			}
+		}
+	default:
+		picked = available[up.next%uint64(len(available))]
+	}
+	up.next++
+	picked.active.Add(1)
+	trial := picked.breaker.begin()
+	var once sync.Once
+	return picked.Url, func(outcome RequestOutcome) {
+		once.Do(func() {
+			picked.active.Add(-1)
+			picked.breaker.done(outcome, trial)
+		})
+	}, true
+}
+
+// =================================================================================
+// ROUTE TABLE
+// =================================================================================
+
+// UpstreamRoute describes an upstream of the route table
+type UpstreamRoute struct {
+	Id        string            `json:"id"`
+	Prefix    string            `json:"prefix"`
+	Hosts     []string          `json:"hosts,omitempty"`
+	Methods   []string          `json:"methods,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Strip     bool              `json:"strip"`
+	Rewrites  []PathRewrite     `json:"rewrites,omitempty"`
+	Filters   int               `json:"filters"`
+	Service   string            `json:"service"`
+	Balancer  Balancer          `json:"balancer"`
+	Uri       string            `json:"uri,omitempty"`
+	Instances []UpstreamAddress `json:"instances"`
+}
+
+// UpstreamAddress is the state of an address of an upstream
+type UpstreamAddress struct {
+	Id          string `json:"id,omitempty"`
+	Url         string `json:"url"`
+	Active      int64  `json:"active"`
+	CircuitOpen bool   `json:"circuitOpen"`
+}
+
+// Routes returns the route table in matching order with the instances of every upstream
+func (u *RouterUpstream) Routes() []UpstreamRoute {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	routes := make([]UpstreamRoute, 0, len(u.ordered))
+	for _, up := range u.ordered {
+		up.mu.Lock()
+		route := UpstreamRoute{
+			Id:        up.Id,
+			Prefix:    up.Prefix,
+			Hosts:     up.Hosts,
+			Methods:   up.Methods,
+			Headers:   up.Headers,
+			Strip:     up.Strip,
+			Rewrites:  up.Rewrites,
+			Filters:   len(up.Filters),
+			Service:   up.Service,
+			Balancer:  up.Balancer,
+			Uri:       up.Uri,
+			Instances: []UpstreamAddress{},
+		}
+		if route.Service == "" {
+			route.Service = up.Id
+		}
+		if route.Balancer == "" {
+			route.Balancer = RoundRobin
+		}
+		for _, instance := range up.instances {
+			route.Instances = append(route.Instances, UpstreamAddress{
+				Id:          instance.Id,
+				Url:         instance.Url,
+				Active:      instance.Active(),
+				CircuitOpen: instance.breaker.Open(),
+			})
+		}
+		up.mu.Unlock()
+		routes = append(routes, route)
+	}
+	return routes
+}
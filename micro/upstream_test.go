@@ -0,0 +1,236 @@
+package micro
+
+import (
+	"context"
+	"github.com/qoalis/go-micro/util/dates"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func acquire(t *testing.T, up *Upstream) (string, func(RequestOutcome)) {
+	uri, release, ok := up.Acquire()
+	assert.True(t, ok)
+	return uri, release
+}
+
+func TestUpstreamRoundRobin(t *testing.T) {
+	upstreams := NewRouterUpstream(map[string]*Upstream{"orders": {Prefix: "/orders", Uri: "http://static"}})
+	up := upstreams.Lookup("/orders/1")
+
+	// the static uri is used until instances are discovered
+	uri, _ := acquire(t, up)
+	assert.Equal(t, "http://static", uri)
+
+	upstreams.SetInstances("orders", []ServiceInstance{{Id: "a", Url: "http://a"}, {Id: "b", Url: "http://b"}})
+	var picked []string
+	for i := 0; i < 4; i++ {
+		uri, release := acquire(t, up)
+		release(RequestSucceeded)
+		picked = append(picked, uri)
+	}
+	assert.ElementsMatch(t, []string{"http://a", "http://b", "http://a", "http://b"}, picked)
+	assert.NotEqual(t, picked[0], picked[1])
+	assert.Equal(t, picked[0], picked[2])
+
+	upstreams.SetInstances("orders", nil)
+	uri, _ = acquire(t, up)
+	assert.Equal(t, "http://static", uri)
+
+	_, _, ok := (&Upstream{}).Acquire()
+	assert.False(t, ok)
+}
+
+func TestUpstreamLeastConnections(t *testing.T) {
+	upstreams := NewRouterUpstream(map[string]*Upstream{"orders": {Prefix: "/orders", Balancer: LeastConnections}})
+	upstreams.SetInstances("orders", []ServiceInstance{{Id: "a", Url: "http://a"}, {Id: "b", Url: "http://b"}})
+	up := upstreams.Lookup("/orders")
+
+	first, releaseFirst := acquire(t, up)
+	second, releaseSecond := acquire(t, up)
+	assert.NotEqual(t, first, second)
+	releaseFirst(RequestSucceeded)
+	releaseFirst(RequestSucceeded)
+
+	// the busy instance is skipped, even when its counter survives an update
+	upstreams.SetInstances("orders", []ServiceInstance{{Id: "a", Url: "http://a"}, {Id: "b", Url: "http://b"}})
+	for i := 0; i < 3; i++ {
+		uri, release := acquire(t, up)
+		assert.Equal(t, first, uri)
+		release(RequestSucceeded)
+	}
+	releaseSecond(RequestSucceeded)
+	for _, instance := range up.Instances() {
+		assert.Equal(t, int64(0), instance.Active())
+	}
+}
+
+func TestUpstreamHeartbeatsAndExpiration(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry := NewMemoryRegistry()
+	registry.Interval = 10 * time.Millisecond
+	upstreams := NewRouterUpstream(map[string]*Upstream{"orders": {Prefix: "/orders"}})
+	assert.Nil(t, upstreams.Watch(ctx, registry))
+	up := upstreams.Lookup("/orders")
+
+	heartbeat, err := Announce(ctx, registry, ServiceInstance{Id: "a", Service: "orders", Url: "http://a"}, 60*time.Millisecond)
+	assert.Nil(t, err)
+	defer func() { _ = heartbeat.Stop(ctx) }()
+	assert.Nil(t, registry.Register(ctx, ServiceInstance{Id: "b", Service: "orders", Url: "http://b"}, 60*time.Millisecond))
+	assert.Eventually(t, func() bool { return len(up.Instances()) == 2 }, time.Second, 5*time.Millisecond)
+
+	// the instance kept alive by its heartbeats outlives its ttl, the other one expires
+	time.Sleep(230 * time.Millisecond)
+	instances := up.Instances()
+	assert.Len(t, instances, 1)
+	assert.Equal(t, "http://a", instances[0].Url)
+	uri, release := acquire(t, up)
+	release(RequestSucceeded)
+	assert.Equal(t, "http://a", uri)
+}
+
+func TestUpstreamWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry := NewMemoryRegistry()
+	upstreams := NewRouterUpstream(map[string]*Upstream{
+		"orders":  {Prefix: "/orders"},
+		"billing": {Prefix: "/billing", Service: "billing-api"},
+	})
+	assert.Nil(t, upstreams.Watch(ctx, registry))
+
+	urls := func(prefix string) func() []string {
+		return func() []string {
+			var result []string
+			for _, instance := range upstreams.Lookup(prefix).Instances() {
+				result = append(result, instance.Url)
+			}
+			return result
+		}
+	}
+	assert.Nil(t, registry.Register(ctx, ServiceInstance{Id: "a", Service: "orders", Url: "http://a"}, time.Minute))
+	assert.Nil(t, registry.Register(ctx, ServiceInstance{Id: "b", Service: "orders", Url: "http://b"}, time.Minute))
+	assert.Nil(t, registry.Register(ctx, ServiceInstance{Id: "c", Service: "billing-api", Url: "http://c"}, time.Minute))
+	assert.Eventually(t, func() bool { return len(urls("/orders")()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Eventually(t, func() bool { return len(urls("/billing")()) == 1 }, time.Second, 5*time.Millisecond)
+
+	assert.Nil(t, registry.Deregister(ctx, "orders", "a"))
+	assert.Eventually(t, func() bool {
+		current := urls("/orders")()
+		return len(current) == 1 && current[0] == "http://b"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	clock := dates.NewFakeClock()
+	dates.SetClock(clock)
+	t.Cleanup(func() { dates.SetClock(nil) })
+	upstreams := NewRouterUpstream(map[string]*Upstream{
+		"orders": {Prefix: "/orders", Uri: "http://static", BreakerThreshold: 2, BreakerCooldown: 10 * time.Second},
+	})
+	up := upstreams.Lookup("/orders")
+
+	for i := 0; i < 2; i++ {
+		_, release := acquire(t, up)
+		release(RequestFailed)
+	}
+	_, _, ok := up.Acquire()
+	assert.False(t, ok)
+
+	// a single trial is let through after the cooldown, an abandoned one is given again
+	clock.Advance(10 * time.Second)
+	_, trial := acquire(t, up)
+	_, _, ok = up.Acquire()
+	assert.False(t, ok)
+	trial(RequestAbandoned)
+	_, trial = acquire(t, up)
+	trial(RequestFailed)
+	_, _, ok = up.Acquire()
+	assert.False(t, ok)
+
+	clock.Advance(10 * time.Second)
+	_, trial = acquire(t, up)
+	trial(RequestSucceeded)
+	for i := 0; i < 3; i++ {
+		_, release := acquire(t, up)
+		release(RequestSucceeded)
+	}
+
+	// the requests sent before the circuit opened do not end the trial
+	_, late := acquire(t, up)
+	_, lateFailure := acquire(t, up)
+	for i := 0; i < 2; i++ {
+		_, release := acquire(t, up)
+		release(RequestFailed)
+	}
+	clock.Advance(10 * time.Second)
+	_, trial = acquire(t, up)
+	late(RequestAbandoned)
+	_, _, ok = up.Acquire()
+	assert.False(t, ok)
+	lateFailure(RequestFailed)
+	clock.Advance(10 * time.Second)
+	_, _, ok = up.Acquire()
+	assert.False(t, ok)
+	trial(RequestSucceeded)
+	_, release := acquire(t, up)
+	release(RequestSucceeded)
+}
+
+func TestUpstreamMatching(t *testing.T) {
+	upstreams := NewRouterUpstream(map[string]*Upstream{
+		"api":      {Prefix: "/api"},
+		"users":    {Prefix: "/api/users"},
+		"writes":   {Prefix: "/api/users", Methods: []string{"POST", "PUT"}},
+		"beta":     {Prefix: "/api/users", Headers: map[string]string{"X-Beta": "yes"}},
+		"tenant":   {Prefix: "/api", Hosts: []string{"*.acme.test"}},
+		"internal": {Prefix: "/api", Headers: map[string]string{"X-Internal": ""}},
+		"v1":       {Prefix: "/v1", Rewrites: []PathRewrite{{Pattern: `^/v1/(\w+)`, Replacement: "/legacy/$1"}, {Pattern: `/$`, Replacement: ""}}},
+	})
+	match := func(method string, target string, host string, headers ...string) string {
+		r := httptest.NewRequest(method, target, nil)
+		r.Host = host
+		for i := 0; i < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		if up := upstreams.Match(r); up != nil {
+			return up.Id
+		}
+		return ""
+	}
+
+	// the result does not depend on the map order
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, "users", upstreams.Lookup("/api/users/1").Id)
+		assert.Equal(t, "users", match("GET", "/api/users/1", "gateway"))
+	}
+	assert.Equal(t, "api", match("GET", "/api/orders", "gateway"))
+	assert.Equal(t, "writes", match("post", "/api/users", "gateway"))
+	assert.Equal(t, "beta", match("GET", "/api/users", "gateway", "X-Beta", "YES"))
+	assert.Equal(t, "users", match("GET", "/api/users", "gateway", "X-Beta", "no"))
+	assert.Equal(t, "tenant", match("GET", "/api/orders", "eu.ACME.test:8080"))
+	assert.Equal(t, "api", match("GET", "/api/orders", "acme.test"))
+	assert.Equal(t, "internal", match("GET", "/api/orders", "gateway", "X-Internal", "1"))
+	assert.Equal(t, "", match("GET", "/other", "gateway"))
+
+	assert.Equal(t, "/legacy/orders/1", upstreams.Lookup("/v1").RewritePath("/v1/orders/1/"))
+
+	routes := upstreams.Routes()
+	var ids []string
+	for _, route := range routes {
+		ids = append(ids, route.Id)
+	}
+	assert.Equal(t, []string{"beta", "writes", "users", "internal", "tenant", "api", "v1"}, ids)
+	assert.Equal(t, "beta", routes[0].Service)
+	assert.Equal(t, RoundRobin, routes[0].Balancer)
+}
+
+func TestUpstreamInvalidRewrite(t *testing.T) {
+	_, err := NewRouterUpstreamE(map[string]*Upstream{"orders": {Prefix: "/orders", Rewrites: []PathRewrite{{Pattern: "^/orders(", Replacement: "/"}}}})
+	assert.ErrorContains(t, err, "invalid rewrite of upstream orders")
+	assert.Panics(t, func() {
+		NewRouterUpstream(map[string]*Upstream{"orders": {Prefix: "/orders", Rewrites: []PathRewrite{{Pattern: "["}}}})
+	})
+}
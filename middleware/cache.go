@@ -0,0 +1,291 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/util/dates"
+	"github.com/qoalis/go-micro/util/ids"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const responseCachePrefix = "httpcache:"
+
+// tagVersionTTL keeps tag versions longer than any cached response
+const tagVersionTTL = 30 * 24 * time.Hour
+
+type ResponseCacheConfig struct {
+	// Cache defaults to ctx.Env.Cache
+	Cache micro.Cache
+	// TTL defaults to the cache ttl
+	TTL time.Duration
+	// VaryHeaders are request headers that are part of the cache key
+	VaryHeaders []string
+	// VaryBy adds the caller to the cache key, e.g. VaryByUser. Authenticated requests are not
+	// cached without it so that a response is never served to another user.
+	VaryBy func(ctx micro.Ctx) string
+	// Tags group responses so they can be invalidated together with InvalidateCacheTags
+	Tags []string
+	// InvalidateOn lists event topics that invalidate the Tags when published
+	InvalidateOn []string
+}
+
+type cachedResponse struct {
+	Status       int                 `json:"status"`
+	Header       map[string][]string `json:"header"`
+	Body         []byte              `json:"body"`
+	ETag         string              `json:"etag"`
+	LastModified time.Time           `json:"last_modified"`
+}
+
+// CacheResponse caches successful GET responses by path, query, tenant and the configured headers.
+// Responses carry ETag/Last-Modified headers and conditional requests are answered with 304.
+// Streamed responses (flushed by the handler or server-sent events) are passed through uncached.
+func CacheResponse(cfg ResponseCacheConfig) micro.MiddlewareFunc {
+	for _, topic := range cfg.InvalidateOn {
+		if err := micro.Subscribe(topic, func(ctx micro.Ctx, _ micro.Event) error {
+			cache := cfg.resolveCache(ctx)
+			if cache == nil {
+				return nil
+			}
+			return InvalidateCacheTags(ctx, cache, cfg.Tags...)
+		}); err != nil {
+			log.Errorf("unable to subscribe to %s for cache invalidation: %s", topic, err)
+		}
+	}
+
+	return func(ctx micro.Ctx) error {
+		req := ctx.Request()
+		cache := cfg.resolveCache(ctx)
+		if req == nil || req.Method != http.MethodGet || cache == nil {
+			return nil
+		}
+		if cfg.VaryBy == nil && authenticated(ctx, req) {
+			return nil
+		}
+		key, err := cfg.key(ctx, cache, req)
+		if err != nil {
+			log.Warnf("response cache disabled for %s: %s", req.URL.Path, err)
+			return nil
+		}
+
+		res := ctx.Response()
+		if !strings.Contains(req.Header.Get("Cache-Control"), "no-cache") {
+			var cached cachedResponse
+			if found, err := cache.Get(ctx, key, &cached); err == nil && found {
+				writeCachedResponse(res, req, cached, "HIT")
+				return micro.ErrResponseCommitted
+			}
+		}
+
+		// buffer the handler response so that the ETag can be emitted before the body
+		original := res.Writer
+		buffer := &bufferedResponseWriter{ResponseWriter: original, status: http.StatusOK}
+		res.Writer = buffer
+		ctx.AfterHandler(func(err error) {
+			res.Writer = original
+			// a failed request is answered by the error handler, on the original writer
+			if err != nil || buffer.streaming {
+				return
+			}
+			if buffer.status != http.StatusOK {
+				original.WriteHeader(buffer.status)
+				_, _ = original.Write(buffer.body.Bytes())
+				return
+			}
+			cached := cachedResponse{
+				Status:       buffer.status,
+				Header:       cacheableHeaders(original.Header()),
+				Body:         buffer.body.Bytes(),
+				ETag:         computeETag(buffer.body.Bytes()),
+				LastModified: dates.Now().Truncate(time.Second),
+			}
+			if err := cache.Set(ctx, key, cached, cfg.TTL); err != nil {
+				log.Warnf("unable to cache response for %s: %s", req.URL.Path, err)
+			}
+			writeCachedResponse(original, req, cached, "MISS")
+		})
+		return nil
+	}
+}
+
+// InvalidateCacheTags invalidates every cached response of the ctx tenant tagged with one of the tags
+func InvalidateCacheTags(ctx micro.Ctx, cache micro.Cache, tags ...string) error {
+	for _, tag := range tags {
+		if err := cache.Set(ctx, responseCachePrefix+"tag:"+tag, ids.NewId(""), tagVersionTTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cfg ResponseCacheConfig) resolveCache(ctx micro.Ctx) micro.Cache {
+	if cfg.Cache != nil {
+		return cfg.Cache
+	}
+	if ctx.Env != nil {
+		return ctx.Env.Cache
+	}
+	return nil
+}
+
+func (cfg ResponseCacheConfig) key(ctx micro.Ctx, cache micro.Cache, req *http.Request) (string, error) {
+	hash := sha256.New()
+	hash.Write([]byte(req.URL.Path))
+	hash.Write([]byte{'?'})
+	hash.Write([]byte(req.URL.Query().Encode()))
+	if cfg.VaryBy != nil {
+		hash.Write([]byte{'\n'})
+		hash.Write([]byte("by:" + cfg.VaryBy(ctx)))
+	}
+	for _, name := range cfg.VaryHeaders {
+		hash.Write([]byte{'\n'})
+		hash.Write([]byte(strings.ToLower(name) + ":" + req.Header.Get(name)))
+	}
+	for _, tag := range cfg.Tags {
+		version, err := tagVersion(ctx, cache, tag)
+		if err != nil {
+			return "", err
+		}
+		hash.Write([]byte{'\n'})
+		hash.Write([]byte(tag + "@" + version))
+	}
+	return responseCachePrefix + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// VaryByUser keys the cached responses by the authenticated user
+func VaryByUser(ctx micro.Ctx) string {
+	if ctx.Auth == nil || !ctx.Auth.Authenticated {
+		return ""
+	}
+	return ctx.Auth.UserId
+}
+
+func authenticated(ctx micro.Ctx, req *http.Request) bool {
+	return req.Header.Get("Authorization") != "" || (ctx.Auth != nil && ctx.Auth.Authenticated)
+}
+
+func tagVersion(ctx micro.Ctx, cache micro.Cache, tag string) (string, error) {
+	var version string
+	key := responseCachePrefix + "tag:" + tag
+	found, err := cache.Get(ctx, key, &version)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		// a lost version must not resurrect responses cached under a previous one
+		version = ids.NewId("")
+		if err = cache.Set(ctx, key, version, tagVersionTTL); err != nil {
+			return "", err
+		}
+	}
+	return version, nil
+}
+
+func writeCachedResponse(w http.ResponseWriter, req *http.Request, cached cachedResponse, status string) {
+	header := w.Header()
+	for k, values := range cached.Header {
+		header[k] = values
+	}
+	header.Set("ETag", cached.ETag)
+	header.Set("Last-Modified", cached.LastModified.UTC().Format(http.TimeFormat))
+	header.Set("X-Cache", status)
+	if notModified(req, cached) {
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(cached.Status)
+	_, _ = w.Write(cached.Body)
+}
+
+func notModified(req *http.Request, cached cachedResponse) bool {
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == cached.ETag {
+				return true
+			}
+		}
+		return false
+	}
+	if since := req.Header.Get("If-Modified-Since"); since != "" {
+		if t, err := http.ParseTime(since); err == nil {
+			return !cached.LastModified.After(t)
+		}
+	}
+	return false
+}
+
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func cacheableHeaders(header http.Header) map[string][]string {
+	result := map[string][]string{}
+	for k, values := range header {
+		switch http.CanonicalHeaderKey(k) {
+		case "Set-Cookie", "Date", "X-Request-Id", "Etag", "Last-Modified", "X-Cache", "Content-Length":
+			continue
+		}
+		result[k] = append([]string{}, values...)
+	}
+	return result
+}
+
+// bufferedResponseWriter holds the response until the handler returns, unless the handler streams
+// it: the response is then written through
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	streaming bool
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	if w.streaming {
+		return
+	}
+	w.status = code
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.stream()
+	}
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
+	}
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.stream()
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+func (w *bufferedResponseWriter) Flush() {
+	w.stream()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// stream writes the buffered response through, the response is not cached
+func (w *bufferedResponseWriter) stream() {
+	if w.streaming {
+		return
+	}
+	w.streaming = true
+	w.Header().Set("X-Cache", "BYPASS")
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.body.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+}
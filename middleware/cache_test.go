@@ -0,0 +1,88 @@
+package middleware_test
+
+import (
+	"fmt"
+	"github.com/qoalis/go-micro/adapters"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/qoalis/go-micro/middleware"
+	"github.com/qoalis/go-micro/tests"
+	"github.com/qoalis/go-micro/util/errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestCacheResponse(t *testing.T) {
+	t.Setenv(micro.ServerToken, "secret")
+	t.Setenv(micro.DatabaseUrl, "file:"+filepath.Join(t.TempDir(), "cache.db"))
+	app := adapters.NewApp("cache", "1.0", micro.Cfg{})
+	app.Init(nil)
+
+	calls := map[string]int{}
+	handler := func(name string) func(ctx micro.Ctx) (any, error) {
+		return func(ctx micro.Ctx) (any, error) {
+			calls[name]++
+			return map[string]any{"calls": calls[name]}, nil
+		}
+	}
+	app.Router.GET("/orders", handler("orders"), middleware.CacheResponse(middleware.ResponseCacheConfig{Tags: []string{"orders"}}))
+	app.Router.GET("/me", handler("me"), middleware.CacheResponse(middleware.ResponseCacheConfig{}))
+	app.Router.GET("/profile", handler("profile"), middleware.CacheResponse(middleware.ResponseCacheConfig{VaryBy: middleware.VaryByUser}))
+	app.Router.GET("/missing", func(ctx micro.Ctx) (any, error) {
+		calls["missing"]++
+		return nil, errors.ResourceNotFound("order_not_found")
+	}, middleware.CacheResponse(middleware.ResponseCacheConfig{}))
+	app.Router.Proxy("/api/*", micro.NewRouterUpstream(map[string]*micro.Upstream{}), middleware.CacheResponse(middleware.ResponseCacheConfig{}))
+	app.Router.GET("/events", func(ctx micro.Ctx) (any, error) {
+		calls["events"]++
+		res := ctx.Response()
+		res.Header().Set("Content-Type", "text/event-stream")
+		res.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintf(res, "data: %d\n\n", calls["events"])
+		res.Flush()
+		return nil, nil
+	}, middleware.CacheResponse(middleware.ResponseCacheConfig{}))
+
+	f := tests.HttpTestApp(t, app, nil)
+
+	// responses are cached with an etag, conditional requests get a 304
+	f.GET("/orders").Expect().IsOK().Header("X-Cache").IsEqual("MISS")
+	hit := f.GET("/orders").Expect().IsOK()
+	hit.Header("X-Cache").IsEqual("HIT")
+	hit.JSON().Object().Path("$.calls").Number().IsEqual(1)
+	etag := hit.Header("ETag").NotEmpty().Raw()
+	f.GET("/orders").Header("If-None-Match", etag).Expect().Status(http.StatusNotModified)
+	f.GET("/orders").Header("Cache-Control", "no-cache").Expect().IsOK().JSON().Object().Path("$.calls").Number().IsEqual(2)
+
+	// the tags invalidate the cached responses
+	assert.Nil(t, middleware.InvalidateCacheTags(micro.NewCtx(app.Env, micro.DefaultTenantId), app.Env.Cache, "orders"))
+	f.GET("/orders").Expect().IsOK().Header("X-Cache").IsEqual("MISS")
+	f.GET("/orders").Header("If-None-Match", etag).Expect().IsOK()
+
+	// authenticated responses are only cached per user
+	f.AsUser("user_1", nil, nil, "").GET("/me").Expect().IsOK()
+	f.AsUser("user_2", nil, nil, "").GET("/me").Expect().IsOK().JSON().Object().Path("$.calls").Number().IsEqual(2)
+	f.AsUser("user_1", nil, nil, "").GET("/profile").Expect().IsOK()
+	f.AsUser("user_1", nil, nil, "").GET("/profile").Expect().IsOK().Header("X-Cache").IsEqual("HIT")
+	f.AsUser("user_2", nil, nil, "").GET("/profile").Expect().IsOK().JSON().Object().Path("$.calls").Number().IsEqual(2)
+
+	// the errors are not cached
+	for i := 0; i < 2; i++ {
+		missing := f.GET("/missing").Expect().IsNotFound()
+		missing.Header("X-Cache").IsEmpty()
+		missing.JSON().Object().ContainsKey("error")
+	}
+	assert.Equal(t, 2, calls["missing"])
+	for i := 0; i < 2; i++ {
+		noUpstream := f.GET("/api/orders").Expect().IsNotFound()
+		noUpstream.Header("X-Cache").IsEmpty()
+		noUpstream.Body().NotEmpty()
+	}
+
+	// streams are passed through
+	f.GET("/events").Expect().IsOK().Body().IsEqual("data: 1\n\n")
+	events := f.GET("/events").Expect().IsOK()
+	events.Header("X-Cache").IsEqual("BYPASS")
+	events.Body().IsEqual("data: 2\n\n")
+}
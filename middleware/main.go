@@ -48,3 +48,23 @@ func TenantRequired() micro.MiddlewareFunc {
 		return nil
 	}
 }
+
+// FlagEnabled hides the route unless the feature flag is enabled for the request, with one of the
+// given variants when there are any
+func FlagEnabled(name string, variants ...string) micro.MiddlewareFunc {
+	return func(ctx micro.Ctx) error {
+		value := ctx.Flag(name)
+		if !value.Enabled {
+			return errors.ResourceNotFound("feature_disabled")
+		}
+		for _, variant := range variants {
+			if value.Variant == variant {
+				return nil
+			}
+		}
+		if len(variants) > 0 {
+			return errors.ResourceNotFound("feature_disabled")
+		}
+		return nil
+	}
+}
@@ -33,3 +33,19 @@ func (h *HealthStatus) SetComponentStatus(name string, err error) {
 		Details: details,
 	}
 }
+
+// SetOptionalComponentStatus reports the component without changing the overall status
+func (h *HealthStatus) SetOptionalComponentStatus(name string, err error) {
+	overall := h.Status
+	h.SetComponentStatus(name, err)
+	h.Status = overall
+}
+
+// WithoutDetails returns a copy of the status without the details of the components
+func (h *HealthStatus) WithoutDetails() *HealthStatus {
+	status := &HealthStatus{Status: h.Status, Components: make(map[string]ComponentStatus, len(h.Components))}
+	for name, component := range h.Components {
+		status.Components[name] = ComponentStatus{Status: component.Status}
+	}
+	return status
+}
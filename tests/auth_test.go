@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"encoding/json"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthHelpers(t *testing.T) {
+	provider := micro.NewJwtTokenProvider("secret")
+	f := HttpTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		claims, err := provider.Decode(token, true)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(claims)
+	}), func() {})
+	defer f.Teardown()
+
+	// the tokens need a provider
+	assert.Equal(t, "no token provider configured, use HttpTestApp or WithTokenProvider", failure(t, func(t testing.TB) {
+		expect := f
+		expect.t = t
+		expect.Token(TokenClaims{})
+	}))
+	f.WithTokenProvider(provider)
+
+	me := f.AsUser("user_1", []string{"admin", "billing"}, []string{"orders:read"}, "acme").GET("/me").Expect().IsOK().JSON()
+	me.Path("$.sub").String().IsEqual("user_1")
+	me.Path("$.tenant").String().IsEqual("acme")
+	me.Path("$.roles").String().IsEqual("admin,billing")
+	me.Path("$.permissions").String().IsEqual("orders:read")
+
+	token := f.Token(TokenClaims{Claims: map[string]any{"plan": "pro"}, TTL: time.Minute})
+	claims, err := provider.Decode(token, true)
+	assert.Nil(t, err)
+	assert.Equal(t, "user", claims["sub"])
+	assert.Equal(t, "pro", claims["plan"])
+
+	// the impersonation only applies to the copies
+	f.GET("/me").Expect().IsUnauthorized()
+	admin := f.WithToken(token)
+	admin.GET("/me").Expect().IsOK()
+	admin.AsAnonymous().GET("/me").Expect().IsUnauthorized()
+	admin.GET("/me").Expect().IsOK()
+
+	f.WithToken(f.ExpiredToken(TokenClaims{Subject: "user_1"})).GET("/me").Expect().IsUnauthorized()
+	f.WithToken(f.BadlySignedToken(TokenClaims{Subject: "user_1"})).GET("/me").Expect().IsUnauthorized()
+	_, err = provider.Decode(f.ExpiredToken(TokenClaims{}), true)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/qoalis/go-micro/micro"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type RecordedEvent struct {
+	Topic    string
+	TenantId string
+	Event    micro.Event
+}
+
+type EventMatcher func(e RecordedEvent) bool
+
+// EventRecorder captures every event published through micro.Publish
+type EventRecorder struct {
+	t      testing.TB
+	mu     sync.Mutex
+	events []RecordedEvent
+}
+
+// recording is set while a recorder is active, the event bus is process wide
+var recording atomic.Bool
+
+// RecordEvents starts recording published events and switches the event bus to synchronous delivery
+// until the end of the test. The event bus and its delivery mode are process wide: the tests recording
+// events must not run in parallel, RecordEvents fails when another recorder is active.
+func RecordEvents(t testing.TB) *EventRecorder {
+	t.Helper()
+	if !recording.CompareAndSwap(false, true) {
+		t.Fatalf("events are already recorded by another test, the tests recording events must not run in parallel")
+	}
+	r := &EventRecorder{t: t}
+	previous := micro.SetSyncDelivery(true)
+	stop := micro.OnPublish(func(ctx micro.Ctx, topic string, payload micro.Event) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.events = append(r.events, RecordedEvent{Topic: topic, TenantId: ctx.TenantId, Event: payload})
+	})
+	t.Cleanup(func() {
+		stop()
+		micro.SetSyncDelivery(previous)
+		recording.Store(false)
+	})
+	return r
+}
+
+// Events returns the recorded events, optionally restricted to the given topics
+func (r *EventRecorder) Events(topics ...string) []RecordedEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]RecordedEvent, 0)
+	for _, e := range r.events {
+		if len(topics) == 0 || contains(topics, e.Topic) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func (r *EventRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = nil
+}
+
+// ExpectPublished fails the test unless an event matching every matcher was published on the topic
+func (r *EventRecorder) ExpectPublished(topic string, matchers ...EventMatcher) RecordedEvent {
+	r.t.Helper()
+	matches := r.find(topic, matchers)
+	if len(matches) == 0 {
+		r.t.Fatalf("expected an event on topic %s, found none among %d recorded on it", topic, len(r.Events(topic)))
+	}
+	return matches[0]
+}
+
+// ExpectPublishedTimes fails the test unless exactly count matching events were published on the topic
+func (r *EventRecorder) ExpectPublishedTimes(topic string, count int, matchers ...EventMatcher) {
+	r.t.Helper()
+	if actual := len(r.find(topic, matchers)); actual != count {
+		r.t.Fatalf("expected %d events on topic %s, got %d", count, topic, actual)
+	}
+}
+
+// ExpectNothingPublished fails the test if any event was published on the given topics (or on any topic)
+func (r *EventRecorder) ExpectNothingPublished(topics ...string) {
+	r.t.Helper()
+	if events := r.Events(topics...); len(events) > 0 {
+		r.t.Fatalf("expected no event to be published, got %d (first on topic %s)", len(events), events[0].Topic)
+	}
+}
+
+func (r *EventRecorder) find(topic string, matchers []EventMatcher) []RecordedEvent {
+	result := make([]RecordedEvent, 0)
+	for _, e := range r.Events(topic) {
+		matches := true
+		for _, m := range matchers {
+			if !m(e) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func WithTenant(tenant string) EventMatcher {
+	return func(e RecordedEvent) bool {
+		return e.TenantId == tenant
+	}
+}
+
+func WithSubject(subject string) EventMatcher {
+	return func(e RecordedEvent) bool {
+		return e.Event.Subject == subject
+	}
+}
+
+func WithEventName(name string) EventMatcher {
+	return func(e RecordedEvent) bool {
+		return e.Event.Event == name
+	}
+}
+
+func WithData(data any) EventMatcher {
+	return func(e RecordedEvent) bool {
+		return fmt.Sprint(e.Event.Data) == fmt.Sprint(data)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"github.com/qoalis/go-micro/micro"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRecordEvents(t *testing.T) {
+	var delivered []string
+	assert.Nil(t, micro.SubscribeAsync("tests.orders", func(ctx micro.Ctx, payload micro.Event) error {
+		delivered = append(delivered, payload.Subject)
+		return nil
+	}))
+
+	t.Run("record", func(t *testing.T) {
+		events := RecordEvents(t)
+		micro.Publish(micro.NewCtx(nil, "acme"), "tests.orders", micro.Event{Subject: "order_1", Event: "created", Data: 10})
+		micro.Publish(micro.NewCtx(nil, "acme"), "tests.orders", micro.Event{Subject: "order_2", Event: "created"})
+		micro.Publish(micro.NewCtx(nil, "other"), "tests.payments", micro.Event{Subject: "payment_1", Event: "failed"})
+
+		// the async subscribers are run inline
+		assert.Equal(t, []string{"order_1", "order_2"}, delivered)
+		assert.Len(t, events.Events(), 3)
+		assert.Len(t, events.Events("tests.payments"), 1)
+		event := events.ExpectPublished("tests.orders", WithTenant("acme"), WithSubject("order_1"), WithData(10))
+		assert.Equal(t, "created", event.Event.Event)
+		events.ExpectPublishedTimes("tests.orders", 2, WithEventName("created"))
+		events.ExpectNothingPublished("tests.users")
+
+		assert.Equal(t, "expected an event on topic tests.orders, found none among 2 recorded on it", failure(t, func(t testing.TB) {
+			recorder := &EventRecorder{t: t, events: events.Events()}
+			recorder.ExpectPublished("tests.orders", WithTenant("other"))
+		}))
+		assert.Equal(t, "expected 1 events on topic tests.orders, got 2", failure(t, func(t testing.TB) {
+			recorder := &EventRecorder{t: t, events: events.Events()}
+			recorder.ExpectPublishedTimes("tests.orders", 1)
+		}))
+
+		// the event bus is process wide, a single test records at once
+		assert.Contains(t, failure(t, func(t testing.TB) {
+			RecordEvents(t)
+		}), "must not run in parallel")
+
+		events.Reset()
+		events.ExpectNothingPublished()
+	})
+
+	// the delivery mode is restored at the end of the test
+	assert.False(t, micro.SetSyncDelivery(false))
+	RecordEvents(t).ExpectNothingPublished()
+}
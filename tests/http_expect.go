@@ -14,18 +14,22 @@ import (
 
 // HttpExpect is for http testing
 type HttpExpect struct {
-	t        *testing.T
-	http     *httpexpect.Expect
-	Teardown func()
+	t             testing.TB
+	http          *httpexpect.Expect
+	tokens        micro.TokenProvider
+	authorization string
+	scrubRules    []ScrubRule
+	Teardown      func()
 }
 
 type HttpTestResult struct {
-	t      *testing.T
-	result *httpexpect.Response
+	t          testing.TB
+	result     *httpexpect.Response
+	scrubRules []ScrubRule
 }
 
 type HttpRequest struct {
-	t             *testing.T
+	t             testing.TB
 	method        string
 	form          bool
 	path          string
@@ -34,6 +38,7 @@ type HttpRequest struct {
 	params        any
 	authorization string
 	headers       map[string]string
+	scrubRules    []ScrubRule
 }
 
 type ValueExpect struct {
@@ -79,6 +84,13 @@ func HttpTest(t *testing.T, handler http.Handler, teardown func()) HttpExpect {
 	}
 }
 
+// HttpTestApp starts a test server for the app router and uses the app TokenProvider to mint tokens
+func HttpTestApp(t *testing.T, app *micro.App, teardown func()) HttpExpect {
+	expect := HttpTest(t, app.Router.Handler(), teardown)
+	expect.tokens = app.Env.TokenProvider
+	return expect
+}
+
 type CrudTestConfig struct {
 	Bearer      string
 	IdPrefix    string
@@ -140,12 +152,14 @@ func (f *HttpExpect) POST(path string, body ...interface{}) *HttpRequest {
 }
 func (f *HttpExpect) POSTForm(path string, body ...interface{}) *HttpRequest {
 	r := &HttpRequest{
-		t:        f.t,
-		internal: f.http,
-		method:   http.MethodPost,
-		form:     true,
-		path:     path,
-		headers:  map[string]string{},
+		t:             f.t,
+		internal:      f.http,
+		method:        http.MethodPost,
+		form:          true,
+		path:          path,
+		authorization: f.authorization,
+		headers:       map[string]string{},
+		scrubRules:    f.scrubRules,
 	}
 	if body != nil {
 		r.body = body[0]
@@ -167,11 +181,13 @@ func (f *HttpExpect) PATCH(path string, body ...interface{}) *HttpRequest {
 
 func (f *HttpExpect) request(method string, path string, body ...interface{}) *HttpRequest {
 	r := &HttpRequest{
-		t:        f.t,
-		internal: f.http,
-		method:   method,
-		path:     path,
-		headers:  map[string]string{},
+		t:             f.t,
+		internal:      f.http,
+		method:        method,
+		path:          path,
+		authorization: f.authorization,
+		headers:       map[string]string{},
+		scrubRules:    f.scrubRules,
 	}
 
 	if body != nil {
@@ -206,8 +222,9 @@ func (r *HttpRequest) Expect() *HttpTestResult {
 		}
 	}
 	return &HttpTestResult{
-		t:      r.t,
-		result: req.Expect(),
+		t:          r.t,
+		result:     req.Expect(),
+		scrubRules: r.scrubRules,
 	}
 }
 
@@ -269,11 +286,30 @@ func (r *HttpTestResult) IsForbidden() *HttpTestResult {
 	return r
 }
 
+func (r *HttpTestResult) IsNotFound() *HttpTestResult {
+	r.result.Status(http.StatusNotFound)
+	return r
+}
+
 func (r *HttpTestResult) Status(status int) *HttpTestResult {
 	r.result.Status(status)
 	return r
 }
 
+// Header returns the value of a response header
+func (r *HttpTestResult) Header(name string) *StringExpect {
+	return &StringExpect{
+		value: r.result.Header(name),
+	}
+}
+
+// Body returns the raw response body
+func (r *HttpTestResult) Body() *StringExpect {
+	return &StringExpect{
+		value: r.result.Body(),
+	}
+}
+
 func (r *HttpTestResult) JSON() *ValueExpect {
 	return &ValueExpect{
 		value: r.result.JSON(),
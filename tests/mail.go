@@ -0,0 +1,302 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/qoalis/go-micro/adapters"
+	"github.com/qoalis/go-micro/micro"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const defaultWaitTimeout = 5 * time.Second
+
+// UseFakeMailer replaces the env mailer with a recording fake (or returns the one already installed)
+func UseFakeMailer(env *micro.Env) *adapters.FakeEmailSender {
+	if fake, ok := env.Mailer.(*adapters.FakeEmailSender); ok {
+		return fake
+	}
+	fake := adapters.NewFakeEmailSender()
+	env.Mailer = fake
+	return fake
+}
+
+// UseFakeNotifier replaces the env notifier with a recording fake (or returns the one already installed)
+func UseFakeNotifier(env *micro.Env) *adapters.FakeNotificationService {
+	if fake, ok := env.Notifier.(*adapters.FakeNotificationService); ok {
+		return fake
+	}
+	fake := adapters.NewFakeNotificationService()
+	env.Notifier = fake
+	return fake
+}
+
+// =================================================================================
+// EMAILS
+// =================================================================================
+
+type EmailExpect struct {
+	t            testing.TB
+	sender       *adapters.FakeEmailSender
+	filters      []func(adapters.SentEmail) bool
+	descriptions []string
+}
+
+func ExpectEmails(t testing.TB, sender *adapters.FakeEmailSender) *EmailExpect {
+	return &EmailExpect{t: t, sender: sender}
+}
+
+func (e *EmailExpect) matching() []adapters.SentEmail {
+	result := make([]adapters.SentEmail, 0)
+	for _, sent := range e.sender.Sent() {
+		matches := true
+		for _, filter := range e.filters {
+			if !filter(sent) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			result = append(result, sent)
+		}
+	}
+	return result
+}
+
+// narrow returns a copy of the expect with one more filter, the filters are only applied by the
+// assertions (WaitFor, Count, IsEmpty, IsNotEmpty, Last)
+func (e *EmailExpect) narrow(description string, filter func(adapters.SentEmail) bool) *EmailExpect {
+	return &EmailExpect{
+		t:            e.t,
+		sender:       e.sender,
+		filters:      append(append([]func(adapters.SentEmail) bool{}, e.filters...), filter),
+		descriptions: append(append([]string{}, e.descriptions...), description),
+	}
+}
+
+func (e *EmailExpect) describe() string {
+	if len(e.descriptions) == 0 {
+		return ""
+	}
+	return " " + strings.Join(e.descriptions, ", ")
+}
+
+// WaitFor waits until at least count matching emails have been sent
+func (e *EmailExpect) WaitFor(count int, timeout ...time.Duration) *EmailExpect {
+	e.t.Helper()
+	if !waitUntil(func() bool { return len(e.matching()) >= count }, timeout...) {
+		e.t.Fatalf("expected at least %d emails%s, got %d", count, e.describe(), len(e.matching()))
+	}
+	return e
+}
+
+func (e *EmailExpect) Count(count int) *EmailExpect {
+	e.t.Helper()
+	if actual := len(e.matching()); actual != count {
+		e.t.Fatalf("expected %d emails%s, got %d among %d sent", count, e.describe(), actual, len(e.sender.Sent()))
+	}
+	return e
+}
+
+func (e *EmailExpect) IsEmpty() *EmailExpect {
+	e.t.Helper()
+	return e.Count(0)
+}
+
+func (e *EmailExpect) IsNotEmpty() *EmailExpect {
+	e.t.Helper()
+	if len(e.matching()) == 0 {
+		e.t.Fatalf("expected an email%s, found none among %d sent", e.describe(), len(e.sender.Sent()))
+	}
+	return e
+}
+
+func (e *EmailExpect) ForTenant(tenant string) *EmailExpect {
+	return e.narrow(fmt.Sprintf("for tenant %s", tenant), func(sent adapters.SentEmail) bool {
+		return sent.TenantId == tenant
+	})
+}
+
+func (e *EmailExpect) SentTo(address string) *EmailExpect {
+	return e.narrow(fmt.Sprintf("sent to %s", address), func(sent adapters.SentEmail) bool {
+		for _, to := range sent.Email.To {
+			if strings.EqualFold(to.Address, address) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (e *EmailExpect) SubjectContains(value string) *EmailExpect {
+	return e.narrow(fmt.Sprintf("with subject containing %q", value), func(sent adapters.SentEmail) bool {
+		return strings.Contains(sent.Email.Subject, value)
+	})
+}
+
+func (e *EmailExpect) TemplateId(value string) *EmailExpect {
+	return e.narrow(fmt.Sprintf("with template %s", value), func(sent adapters.SentEmail) bool {
+		return sent.Email.TemplateId == value
+	})
+}
+
+func (e *EmailExpect) TemplateDataEquals(key string, value any) *EmailExpect {
+	return e.narrow(fmt.Sprintf("with template data %s=%v", key, value), func(sent adapters.SentEmail) bool {
+		actual, ok := sent.Email.TemplateData[key]
+		return ok && (reflect.DeepEqual(actual, value) || fmt.Sprint(actual) == fmt.Sprint(value))
+	})
+}
+
+// Last returns the last matching email
+func (e *EmailExpect) Last() micro.Email {
+	e.t.Helper()
+	matches := e.matching()
+	if len(matches) == 0 {
+		e.t.Fatalf("expected an email%s, found none among %d sent", e.describe(), len(e.sender.Sent()))
+	}
+	return matches[len(matches)-1].Email
+}
+
+// Render returns a preview of the last matching email
+func (e *EmailExpect) Render() string {
+	e.t.Helper()
+	return e.sender.Render(e.Last())
+}
+
+// =================================================================================
+// NOTIFICATIONS
+// =================================================================================
+
+type NotificationExpect struct {
+	t            testing.TB
+	service      *adapters.FakeNotificationService
+	filters      []func(adapters.SentNotification) bool
+	descriptions []string
+}
+
+func ExpectNotifications(t testing.TB, service *adapters.FakeNotificationService) *NotificationExpect {
+	return &NotificationExpect{t: t, service: service}
+}
+
+func (e *NotificationExpect) matching() []adapters.SentNotification {
+	result := make([]adapters.SentNotification, 0)
+	for _, sent := range e.service.Sent() {
+		matches := true
+		for _, filter := range e.filters {
+			if !filter(sent) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			result = append(result, sent)
+		}
+	}
+	return result
+}
+
+// narrow returns a copy of the expect with one more filter, the filters are only applied by the
+// assertions (WaitFor, Count, IsEmpty, IsNotEmpty, Last)
+func (e *NotificationExpect) narrow(description string, filter func(adapters.SentNotification) bool) *NotificationExpect {
+	return &NotificationExpect{
+		t:            e.t,
+		service:      e.service,
+		filters:      append(append([]func(adapters.SentNotification) bool{}, e.filters...), filter),
+		descriptions: append(append([]string{}, e.descriptions...), description),
+	}
+}
+
+func (e *NotificationExpect) describe() string {
+	if len(e.descriptions) == 0 {
+		return ""
+	}
+	return " " + strings.Join(e.descriptions, ", ")
+}
+
+// WaitFor waits until at least count matching notifications have been sent
+func (e *NotificationExpect) WaitFor(count int, timeout ...time.Duration) *NotificationExpect {
+	e.t.Helper()
+	if !waitUntil(func() bool { return len(e.matching()) >= count }, timeout...) {
+		e.t.Fatalf("expected at least %d notifications%s, got %d", count, e.describe(), len(e.matching()))
+	}
+	return e
+}
+
+func (e *NotificationExpect) Count(count int) *NotificationExpect {
+	e.t.Helper()
+	if actual := len(e.matching()); actual != count {
+		e.t.Fatalf("expected %d notifications%s, got %d among %d sent", count, e.describe(), actual, len(e.service.Sent()))
+	}
+	return e
+}
+
+func (e *NotificationExpect) IsEmpty() *NotificationExpect {
+	e.t.Helper()
+	return e.Count(0)
+}
+
+func (e *NotificationExpect) IsNotEmpty() *NotificationExpect {
+	e.t.Helper()
+	if len(e.matching()) == 0 {
+		e.t.Fatalf("expected a notification%s, found none among %d sent", e.describe(), len(e.service.Sent()))
+	}
+	return e
+}
+
+func (e *NotificationExpect) ForTenant(tenant string) *NotificationExpect {
+	return e.narrow(fmt.Sprintf("for tenant %s", tenant), func(sent adapters.SentNotification) bool {
+		return sent.TenantId == tenant
+	})
+}
+
+func (e *NotificationExpect) MessageContains(value string) *NotificationExpect {
+	return e.narrow(fmt.Sprintf("with message containing %q", value), func(sent adapters.SentNotification) bool {
+		return strings.Contains(sent.Notification.Message, value)
+	})
+}
+
+func (e *NotificationExpect) WithSeverity(severity micro.Severity) *NotificationExpect {
+	return e.narrow(fmt.Sprintf("with severity %s", severity), func(sent adapters.SentNotification) bool {
+		return sent.Notification.Severity == severity
+	})
+}
+
+func (e *NotificationExpect) WithTopic(topic string) *NotificationExpect {
+	return e.narrow(fmt.Sprintf("with topic %s", topic), func(sent adapters.SentNotification) bool {
+		return sent.Notification.Topic == topic
+	})
+}
+
+// Last returns the last matching notification
+func (e *NotificationExpect) Last() micro.Notification {
+	e.t.Helper()
+	matches := e.matching()
+	if len(matches) == 0 {
+		e.t.Fatalf("expected a notification%s, found none among %d sent", e.describe(), len(e.service.Sent()))
+	}
+	return matches[len(matches)-1].Notification
+}
+
+// =================================================================================
+// HELPERS
+// =================================================================================
+
+// waitUntil drains the async event bus then polls the condition until the timeout expires
+func waitUntil(condition func() bool, timeout ...time.Duration) bool {
+	limit := defaultWaitTimeout
+	if len(timeout) > 0 {
+		limit = timeout[0]
+	}
+	deadline := time.Now().Add(limit)
+	for {
+		micro.WaitAsync()
+		if condition() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/qoalis/go-micro/adapters"
+	"github.com/qoalis/go-micro/micro"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// recordingT records the failures of the helpers instead of failing the test
+type recordingT struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Fatalf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+	runtime.Goexit()
+}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+// failure runs the assertion in its own goroutine, since Fatalf stops it, and returns its failure
+func failure(t *testing.T, assertion func(t testing.TB)) string {
+	recorder := &recordingT{TB: t}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assertion(recorder)
+	}()
+	<-done
+	if len(recorder.failures) == 0 {
+		return ""
+	}
+	return recorder.failures[0]
+}
+
+func TestExpectEmails(t *testing.T) {
+	sender := adapters.NewFakeEmailSender()
+	ctx := micro.NewCtx(nil, "acme")
+	assert.Nil(t, sender.Send(ctx, micro.Email{
+		To:           []micro.EmailAddress{{Address: "Jane@example.com"}},
+		Subject:      "Welcome Jane",
+		TemplateId:   "welcome",
+		TemplateData: map[string]any{"count": 2},
+	}))
+
+	emails := ExpectEmails(t, sender)
+	emails.Count(1).IsNotEmpty()
+	emails.ForTenant("acme").SentTo("jane@example.com").SubjectContains("Welcome").Count(1)
+	emails.TemplateId("welcome").TemplateDataEquals("count", "2").IsNotEmpty()
+	assert.Equal(t, "Welcome Jane", emails.SentTo("jane@example.com").Last().Subject)
+
+	// the filters are lazy, only the assertions fail
+	emails.SentTo("john@example.com").IsEmpty()
+	emails.ForTenant("other").Count(0)
+	assert.Equal(t, "expected an email for tenant other, sent to jane@example.com, found none among 1 sent", failure(t, func(t testing.TB) {
+		ExpectEmails(t, sender).ForTenant("other").SentTo("jane@example.com").Last()
+	}))
+	assert.Equal(t, "expected 2 emails with template welcome, got 1 among 1 sent", failure(t, func(t testing.TB) {
+		ExpectEmails(t, sender).TemplateId("welcome").Count(2)
+	}))
+
+	// emails sent later are waited for
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = sender.Send(ctx, micro.Email{To: []micro.EmailAddress{{Address: "john@example.com"}}})
+	}()
+	emails.SentTo("john@example.com").WaitFor(1, time.Second)
+	assert.Equal(t, "expected at least 1 emails sent to nobody@example.com, got 0", failure(t, func(t testing.TB) {
+		ExpectEmails(t, sender).SentTo("nobody@example.com").WaitFor(1, 20*time.Millisecond)
+	}))
+}
+
+func TestExpectNotifications(t *testing.T) {
+	service := adapters.NewFakeNotificationService()
+	ctx := micro.NewCtx(nil, "acme")
+	assert.Nil(t, service.Send(ctx, micro.Notification{Message: "payment failed", Severity: micro.SeverityError, Topic: "billing"}))
+
+	notifications := ExpectNotifications(t, service)
+	notifications.ForTenant("acme").MessageContains("payment").WithSeverity(micro.SeverityError).WithTopic("billing").Count(1)
+	notifications.WithTopic("orders").IsEmpty()
+	assert.Equal(t, "payment failed", notifications.Last().Message)
+	assert.Equal(t, "expected a notification with severity warning, found none among 1 sent", failure(t, func(t testing.TB) {
+		ExpectNotifications(t, service).WithSeverity(micro.SeverityWarning).IsNotEmpty()
+	}))
+}
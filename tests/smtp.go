@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type SmtpMessage struct {
+	From     string
+	To       []string
+	Data     string
+	Username string
+}
+
+// SmtpServer is a minimal SMTP stand-in recording the delivered messages (no TLS, AUTH PLAIN accepted)
+type SmtpServer struct {
+	t        *testing.T
+	listener net.Listener
+	mu       sync.Mutex
+	messages []SmtpMessage
+}
+
+// NewSmtpServer starts a local SMTP server stopped at the end of the test
+func NewSmtpServer(t *testing.T) *SmtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to start smtp server: %s", err)
+	}
+	s := &SmtpServer{t: t, listener: listener}
+	go s.serve()
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	return s
+}
+
+func (s *SmtpServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Url returns an EMAIL_SENDER compatible url for the server
+func (s *SmtpServer) Url() string {
+	return fmt.Sprintf("smtp://user:secret@%s?tls=none", s.Addr())
+}
+
+func (s *SmtpServer) Messages() []SmtpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SmtpMessage{}, s.messages...)
+}
+
+// WaitFor waits until at least count messages have been delivered
+func (s *SmtpServer) WaitFor(count int, timeout ...time.Duration) []SmtpMessage {
+	s.t.Helper()
+	if !waitUntil(func() bool { return len(s.Messages()) >= count }, timeout...) {
+		s.t.Fatalf("expected at least %d smtp messages, got %d", count, len(s.Messages()))
+	}
+	return s.Messages()
+}
+
+func (s *SmtpServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *SmtpServer) handle(conn net.Conn) {
+	//goland:noinspection ALL
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP test server")
+	var current SmtpMessage
+	username := ""
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250-localhost")
+			_ = tp.PrintfLine("250-8BITMIME")
+			_ = tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			if parts := strings.Fields(arg); len(parts) == 2 {
+				if decoded, err := base64.StdEncoding.DecodeString(parts[1]); err == nil {
+					if fields := strings.Split(string(decoded), "\x00"); len(fields) == 3 {
+						username = fields[1]
+					}
+				}
+			}
+			_ = tp.PrintfLine("235 2.7.0 Authentication successful")
+		case "MAIL":
+			current = SmtpMessage{From: trimAddress(arg), Username: username}
+			_ = tp.PrintfLine("250 OK")
+		case "RCPT":
+			current.To = append(current.To, trimAddress(arg))
+			_ = tp.PrintfLine("250 OK")
+		case "DATA":
+			_ = tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := readData(tp.Reader.R)
+			if err != nil {
+				return
+			}
+			current.Data = data
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			current = SmtpMessage{Username: username}
+			_ = tp.PrintfLine("250 OK queued")
+		case "RSET":
+			current = SmtpMessage{Username: username}
+			_ = tp.PrintfLine("250 OK")
+		case "NOOP":
+			_ = tp.PrintfLine("250 OK")
+		case "QUIT":
+			_ = tp.PrintfLine("221 Bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func readData(r *bufio.Reader) (string, error) {
+	var b strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			return b.String(), nil
+		}
+		b.WriteString(strings.TrimPrefix(line, "."))
+	}
+}
+
+func trimAddress(arg string) string {
+	_, value, found := strings.Cut(arg, ":")
+	if !found {
+		value = arg
+	}
+	value = strings.TrimSpace(value)
+	if i := strings.Index(value, " "); i > 0 {
+		value = value[:i]
+	}
+	return strings.Trim(value, "<>")
+}
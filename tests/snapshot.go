@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/qoalis/go-micro/util/ids"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// UpdateSnapshotsEnv rewrites every golden file instead of comparing when set to true
+const UpdateSnapshotsEnv = "UPDATE_SNAPSHOTS"
+
+// SnapshotDir is the folder (relative to the test package) holding the golden files
+var SnapshotDir = filepath.Join("testdata", "snapshots")
+
+var updateSnapshots = flag.Bool("update-snapshots", false, "rewrite snapshot golden files")
+
+// ScrubRule replaces volatile values before a response is compared to its snapshot.
+// Values under one of the Keys (at any depth) are replaced, as well as string values matching Pattern.
+type ScrubRule struct {
+	Keys        []string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+var timestampPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?$`)
+
+// DefaultScrubRules replaces generated ids, timestamps and request ids
+var DefaultScrubRules = []ScrubRule{
+	{Keys: []string{"request_id", "requestId", "X-Request-Id"}, Replacement: "<request_id>"},
+	{Pattern: ids.Pattern, Replacement: "<id>"},
+	{Pattern: timestampPattern, Replacement: "<timestamp>"},
+}
+
+// ScrubRules returns a copy of the expect where the rules are applied (after the default ones) by MatchSnapshot
+func (f *HttpExpect) ScrubRules(rules ...ScrubRule) *HttpExpect {
+	clone := *f
+	clone.scrubRules = append(append([]ScrubRule{}, f.scrubRules...), rules...)
+	return &clone
+}
+
+// MatchSnapshot compares the (scrubbed) response body with the golden file testdata/snapshots/<test>/<name>.json.
+// The golden files are only written in update mode (-update-snapshots flag or UPDATE_SNAPSHOTS=true),
+// a missing one fails the test.
+func (r *HttpTestResult) MatchSnapshot(name string) *HttpTestResult {
+	r.t.Helper()
+	actual := scrubBody(r.result.Body().Raw(), append(append([]ScrubRule{}, DefaultScrubRules...), r.scrubRules...))
+	file := filepath.Join(SnapshotDir, sanitizeSnapshotName(r.t.Name()), sanitizeSnapshotName(name)+".json")
+
+	expected, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		r.t.Fatalf("unable to read snapshot %s: %s", file, err)
+	}
+	if !shouldUpdateSnapshots() && os.IsNotExist(err) {
+		r.t.Fatalf("snapshot %s is missing (run with %s=true to write it)", file, UpdateSnapshotsEnv)
+	}
+	if shouldUpdateSnapshots() {
+		if err = os.MkdirAll(filepath.Dir(file), 0o755); err == nil {
+			err = os.WriteFile(file, []byte(actual), 0o644)
+		}
+		if err != nil {
+			r.t.Fatalf("unable to write snapshot %s: %s", file, err)
+		}
+		r.t.Logf("snapshot written: %s", file)
+		return r
+	}
+	assert.Equal(r.t, string(expected), actual, "response does not match snapshot %s (run with %s=true to update)", file, UpdateSnapshotsEnv)
+	return r
+}
+
+func shouldUpdateSnapshots() bool {
+	return *updateSnapshots || os.Getenv(UpdateSnapshotsEnv) == "true" || os.Getenv(UpdateSnapshotsEnv) == "1"
+}
+
+func scrubBody(body string, rules []ScrubRule) string {
+	var data interface{}
+	// the numbers are kept as written, float64 would round the ids above 2^53
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	err := decoder.Decode(&data)
+	if err == nil && decoder.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("unexpected data after the json document")
+	}
+	if err != nil {
+		// not a json document, only apply the patterns on the raw text
+		return fmt.Sprint(scrubValue("", body, rules)) + "\n"
+	}
+	var out strings.Builder
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(scrubValue("", data, rules))
+	return out.String()
+}
+
+func scrubValue(key string, value interface{}, rules []ScrubRule) interface{} {
+	for _, rule := range rules {
+		for _, k := range rule.Keys {
+			if key != "" && strings.EqualFold(k, key) {
+				return rule.Replacement
+			}
+		}
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = scrubValue(k, item, rules)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = scrubValue("", item, rules)
+		}
+		return v
+	case string:
+		for _, rule := range rules {
+			if rule.Pattern != nil && rule.Pattern.MatchString(v) {
+				return rule.Replacement
+			}
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+var unsafeSnapshotChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+func sanitizeSnapshotName(name string) string {
+	return unsafeSnapshotChars.ReplaceAllString(name, "_")
+}
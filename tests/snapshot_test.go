@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/qoalis/go-micro/util/ids"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestMatchSnapshot(t *testing.T) {
+	dir := SnapshotDir
+	SnapshotDir = t.TempDir()
+	t.Cleanup(func() { SnapshotDir = dir })
+	t.Setenv(UpdateSnapshotsEnv, "")
+
+	total := 10
+	f := HttpTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"id":"%s","requestId":"abc","createdAt":"2024-01-01T10:00:00Z","total":%d,"code":"ORD-%d"}`,
+			ids.NewId("ord"), total, total)
+	}), func() {})
+	defer f.Teardown()
+	scrubbed := f.ScrubRules(ScrubRule{Pattern: regexp.MustCompile(`^ORD-\d+$`), Replacement: "<code>"})
+	match := func(expect *HttpExpect) func(t testing.TB) {
+		return func(t testing.TB) {
+			result := expect.GET("/orders/1").Expect().IsOK()
+			result.t = t
+			result.MatchSnapshot("order")
+		}
+	}
+	file := filepath.Join(SnapshotDir, "TestMatchSnapshot", "order.json")
+
+	// a missing snapshot fails unless the update mode is on
+	assert.Contains(t, failure(t, match(scrubbed)), "snapshot "+file+" is missing")
+	assert.NoFileExists(t, file)
+	t.Setenv(UpdateSnapshotsEnv, "true")
+	assert.Equal(t, "", failure(t, match(scrubbed)))
+	content, err := os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, `{
+  "code": "<code>",
+  "createdAt": "<timestamp>",
+  "id": "<id>",
+  "requestId": "<request_id>",
+  "total": 10
+}
+`, string(content))
+
+	t.Setenv(UpdateSnapshotsEnv, "")
+	assert.Equal(t, "", failure(t, match(scrubbed)))
+	total = 20
+	assert.Contains(t, failure(t, match(scrubbed)), "response does not match snapshot "+file)
+
+	// the rules are only applied by the copy they were added to
+	assert.Empty(t, f.scrubRules)
+	total = 10
+	assert.Contains(t, failure(t, match(&f)), "response does not match snapshot "+file)
+}
+
+func TestScrubBodyKeepsNumbers(t *testing.T) {
+	// the large ints are not rounded through float64
+	assert.Equal(t, "{\n  \"id\": 9007199254740993,\n  \"ratio\": 0.10,\n  \"total\": 1e3\n}\n",
+		scrubBody(`{"id":9007199254740993,"ratio":0.10,"total":1e3}`, nil))
+
+	// the bodies with trailing data are not json documents
+	assert.Equal(t, "{\"id\":1} {\"id\":2}\n", scrubBody(`{"id":1} {"id":2}`, nil))
+}
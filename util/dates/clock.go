@@ -0,0 +1,142 @@
+package dates
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time used by the framework (tokens, scheduler, caches, entities)
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now().UTC()
+}
+
+// RealClock is backed by the wall clock
+var RealClock Clock = realClock{}
+
+var (
+	clockMu sync.RWMutex
+	current = RealClock
+)
+
+// SetClock replaces the clock used by Now and friends, nil restores the wall clock
+func SetClock(clock Clock) {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	if clock == nil {
+		clock = RealClock
+	}
+	current = clock
+}
+
+func CurrentClock() Clock {
+	clockMu.RLock()
+	defer clockMu.RUnlock()
+	return current
+}
+
+// =================================================================================
+// FAKE CLOCK
+// =================================================================================
+
+type fakeJob struct {
+	id       int
+	next     time.Time
+	interval time.Duration
+	limit    int
+	runs     int
+	fn       func()
+}
+
+// FakeClock is a manually driven clock; jobs registered with Every run when Advance moves past them
+type FakeClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	seq  int
+	jobs []*fakeJob
+}
+
+func NewFakeClock(start ...time.Time) *FakeClock {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if len(start) > 0 {
+		now = start[0].UTC()
+	}
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set moves the clock to the given time without firing jobs
+func (c *FakeClock) Set(value time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = value.UTC()
+}
+
+// Every registers a job due immediately then every interval, limit > 0 caps the number of runs
+func (c *FakeClock) Every(interval time.Duration, limit int, fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	c.jobs = append(c.jobs, &fakeJob{
+		id:       c.seq,
+		next:     c.now,
+		interval: interval,
+		limit:    limit,
+		fn:       fn,
+	})
+}
+
+// Advance moves the clock forward, running every due job in chronological order
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	c.mu.Unlock()
+
+	for {
+		job := c.nextDue(target)
+		if job == nil {
+			break
+		}
+		job.fn()
+	}
+
+	c.mu.Lock()
+	c.now = target
+	c.mu.Unlock()
+}
+
+func (c *FakeClock) nextDue(target time.Time) *fakeJob {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sort.SliceStable(c.jobs, func(i, j int) bool {
+		if c.jobs[i].next.Equal(c.jobs[j].next) {
+			return c.jobs[i].id < c.jobs[j].id
+		}
+		return c.jobs[i].next.Before(c.jobs[j].next)
+	})
+	if len(c.jobs) == 0 || c.jobs[0].next.After(target) {
+		return nil
+	}
+	job := c.jobs[0]
+	if job.next.After(c.now) {
+		c.now = job.next
+	}
+	job.runs++
+	if (job.limit > 0 && job.runs >= job.limit) || job.interval <= 0 {
+		c.jobs = c.jobs[1:]
+	} else {
+		job.next = job.next.Add(job.interval)
+	}
+	return job
+}
@@ -0,0 +1,37 @@
+package dates
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFakeClockAdvance(t *testing.T) {
+	clock := NewFakeClock()
+	start := clock.Now()
+
+	var ticks []time.Time
+	clock.Every(time.Minute, 0, func() {
+		ticks = append(ticks, clock.Now())
+	})
+	once := 0
+	clock.Every(time.Second, 1, func() {
+		once++
+	})
+
+	clock.Advance(150 * time.Second)
+
+	assert.Equal(t, 1, once)
+	assert.Equal(t, []time.Time{start, start.Add(time.Minute), start.Add(2 * time.Minute)}, ticks)
+	assert.Equal(t, start.Add(150*time.Second), clock.Now())
+}
+
+func TestSetClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2030, 5, 1, 10, 0, 0, 0, time.UTC))
+	SetClock(clock)
+	defer SetClock(nil)
+
+	assert.Equal(t, clock.Now(), Now())
+	clock.Advance(Days(1))
+	assert.Equal(t, time.Date(2030, 5, 2, 10, 0, 0, 0, time.UTC), Now())
+}
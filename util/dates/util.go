@@ -5,22 +5,22 @@ import (
 )
 
 func Now() time.Time {
-	return time.Now().UTC()
+	return CurrentClock().Now().UTC()
 }
 
 func NowPrt() *time.Time {
-	value := time.Now().UTC()
+	value := Now()
 	return &value
 }
 
 func NowPtrPlus(d time.Duration) *time.Time {
-	value := time.Now().UTC()
+	value := Now()
 	value = value.Add(d)
 	return &value
 }
 
 func NowPlus(d time.Duration) time.Time {
-	value := time.Now().UTC()
+	value := Now()
 	value = value.Add(d)
 	return value
 }
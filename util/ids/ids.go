@@ -3,9 +3,13 @@ package ids
 import (
 	"github.com/qoalis/go-micro/util/h"
 	"github.com/rs/xid"
+	"regexp"
 	"strings"
 )
 
+// Pattern matches the values generated by NewId (optional prefix followed by a xid)
+var Pattern = regexp.MustCompile(`^(?:[A-Za-z0-9]+[_-])?[0-9a-v]{20}$`)
+
 func NewId(prefix string) string {
 	guid := xid.New()
 	if h.IsNotEmpty(prefix) && !strings.HasSuffix(prefix, "_") && !strings.HasSuffix(prefix, "-") {
@@ -18,3 +22,7 @@ func NewIdPtr(prefix string) *string {
 	value := NewId(prefix)
 	return &value
 }
+
+func IsId(value string) bool {
+	return Pattern.MatchString(value)
+}
@@ -11,5 +11,8 @@ func TestId(t *testing.T) {
 	assert.NotEmpty(t, value)
 	assert.True(t, strings.HasPrefix(value, "test_"))
 	assert.True(t, len(value) > 10)
+	assert.True(t, IsId(value))
+	assert.True(t, IsId(NewId("")))
+	assert.False(t, IsId("hello"))
 
 }